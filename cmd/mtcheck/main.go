@@ -0,0 +1,71 @@
+// mtcheck verifies the consistency of a merkletree stored in a LevelDB
+// database, reporting every node that is missing, has a key that doesn't
+// match its value, or is not in its expected position.  It exits with status 1
+// if any problem is found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	common3 "github.com/iden3/go-iden3-core/common"
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/iden3/go-iden3-core/merkletree"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run checks the tree and returns the exit status.
+func run() int {
+	path := flag.String("db", "", "path of the LevelDB database")
+	root := flag.String("root", "", "root key of the tree to check in hex (default: current root)")
+	prefix := flag.String("prefix", "", "prefix in hex of the storage of the tree, if any")
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		return 2
+	}
+
+	storage, err := db.NewLevelDbStorage(*path, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer storage.Close()
+
+	var st db.Storage = storage
+	if *prefix != "" {
+		p, err := common3.HexDecode(*prefix)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid prefix:", err)
+			return 2
+		}
+		st = st.WithPrefix(p)
+	}
+	var rootKey *merkletree.Hash
+	if *root != "" {
+		rootKey = &merkletree.Hash{}
+		if err := common3.HexDecodeInto(rootKey[:], []byte(*root)); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid root:", err)
+			return 2
+		}
+	}
+
+	report, err := merkletree.Check(st, rootKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, e := range report.Errors {
+		fmt.Println(e)
+	}
+	fmt.Printf("root %v: %v nodes, %v leafs, %v problems\n", report.Root.Hex(),
+		report.Nodes, report.Leafs, len(report.Errors))
+	if !report.Ok() {
+		return 1
+	}
+	return 0
+}
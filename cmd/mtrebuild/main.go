@@ -0,0 +1,108 @@
+// mtrebuild copies all the claims of a merkletree stored in a LevelDB database
+// into a new merkletree with a different number of levels, in the same
+// database under another prefix or in another database.  If some claims
+// can't be in the same tree of the new number of levels, they are reported
+// and nothing is written.  The source merkletree is opened read only, and it
+// must exist, while the destination must not contain a merkletree with claims.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	common3 "github.com/iden3/go-iden3-core/common"
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/iden3/go-iden3-core/merkletree"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// withHexPrefix returns the storage with the prefix in hex, if any.
+func withHexPrefix(st db.Storage, prefix string) (db.Storage, error) {
+	if prefix == "" {
+		return st, nil
+	}
+	p, err := common3.HexDecode(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return st.WithPrefix(p), nil
+}
+
+// run rebuilds the tree and returns the exit status.
+func run() int {
+	path := flag.String("db", "", "path of the LevelDB database")
+	root := flag.String("root", "", "root key of the tree to rebuild in hex (default: current root)")
+	prefix := flag.String("prefix", "", "prefix in hex of the storage of the tree, if any")
+	levels := flag.Int("levels", 140, "number of levels of the tree")
+	dstPath := flag.String("dst-db", "", "path of the LevelDB database of the new tree (default: -db)")
+	dstPrefix := flag.String("dst-prefix", "", "prefix in hex of the storage of the new tree, if any")
+	dstLevels := flag.Int("dst-levels", 0, "number of levels of the new tree")
+	flag.Parse()
+	if *path == "" || *dstLevels <= 0 || (*dstPath == "" && *dstPrefix == *prefix) {
+		flag.Usage()
+		return 2
+	}
+
+	storage, err := db.NewLevelDbStorage(*path, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer storage.Close()
+	dstStorage := storage
+	if *dstPath != "" {
+		if dstStorage, err = db.NewLevelDbStorage(*dstPath, false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer dstStorage.Close()
+	}
+
+	st, err := withHexPrefix(storage, *prefix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid prefix:", err)
+		return 2
+	}
+	dst, err := withHexPrefix(dstStorage, *dstPrefix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid dst-prefix:", err)
+		return 2
+	}
+	var rootKey *merkletree.Hash
+	if *root != "" {
+		rootKey = &merkletree.Hash{}
+		if err := common3.HexDecodeInto(rootKey[:], []byte(*root)); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid root:", err)
+			return 2
+		}
+	}
+
+	mt, err := merkletree.OpenMerkleTree(st, *levels)
+	if err == db.ErrNotFound {
+		fmt.Fprintln(os.Stderr, "no merkletree found in the database with the given prefix")
+		return 2
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newMt, collisions, err := mt.Rebuild(rootKey, dst, *dstLevels)
+	if err == merkletree.ErrReachedMaxLevel && len(collisions) > 0 {
+		for _, entries := range collisions {
+			fmt.Println("colliding claims:")
+			for _, e := range entries {
+				fmt.Printf("  %v\n", common3.HexEncode(e.Bytes()))
+			}
+		}
+		fmt.Printf("%v groups of claims collide with %v levels\n", len(collisions), *dstLevels)
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Printf("rebuilt root %v with %v levels\n", newMt.RootKey().Hex(), *dstLevels)
+	return 0
+}
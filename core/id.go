@@ -173,7 +173,7 @@ func CalculateIdGenesis(claimKOp *merkletree.Entry, extraGenesisClaims []*merkle
 
 	idGenesis := mt.RootKey()
 
-	proofClaimKOp, err := GetClaimProofByHi(mt, claimKOp.HIndex())
+	proofClaimKOp, err := GetClaimProofByHi(mt, mt.HIndex(claimKOp))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -222,19 +222,19 @@ func CalculateIdGenesisFrom4Keys(kop *babyjub.PublicKey, kdis, kreen, kupdateRoo
 
 	idGenesis := mt.RootKey()
 
-	proofClaimKOp, err := GetClaimProofByHi(mt, claimKOp.Entry().HIndex())
+	proofClaimKOp, err := GetClaimProofByHi(mt, mt.HIndex(claimKOp.Entry()))
 	if err != nil {
 		return nil, nil, err
 	}
-	proofClaimKDis, err := GetClaimProofByHi(mt, claimKDis.Entry().HIndex())
+	proofClaimKDis, err := GetClaimProofByHi(mt, mt.HIndex(claimKDis.Entry()))
 	if err != nil {
 		return nil, nil, err
 	}
-	proofClaimKReen, err := GetClaimProofByHi(mt, claimKReen.Entry().HIndex())
+	proofClaimKReen, err := GetClaimProofByHi(mt, mt.HIndex(claimKReen.Entry()))
 	if err != nil {
 		return nil, nil, err
 	}
-	proofClaimKUpdateRoot, err := GetClaimProofByHi(mt, claimKUpdateRoot.Entry().HIndex())
+	proofClaimKUpdateRoot, err := GetClaimProofByHi(mt, mt.HIndex(claimKUpdateRoot.Entry()))
 	if err != nil {
 		return nil, nil, err
 	}
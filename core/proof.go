@@ -90,7 +90,7 @@ func (p *ProofClaimGenesis) Verify() error {
 	if !p.Id.Equal(rootId) {
 		return fmt.Errorf("Id was not calculated from Root")
 	}
-	if !merkletree.VerifyProof(p.Root, p.Mtp, p.Claim.HIndex(), p.Claim.HValue()) {
+	if !merkletree.VerifyProofEntry(p.Root, p.Mtp, p.Claim) {
 		return fmt.Errorf("Mtp doesn't match with the Root")
 	}
 	return nil
@@ -134,7 +134,7 @@ func VerifyProofClaim(operationalPk *babyjub.PublicKey, pc *ProofClaim) (bool, e
 		if !mtpEx.Existence {
 			return false, fmt.Errorf("Mtp0 at lvl %v is a non-existence proof", i)
 		}
-		if !merkletree.VerifyProof(rootKey, mtpEx, leaf.HIndex(), leaf.HValue()) {
+		if !merkletree.VerifyProofEntry(rootKey, mtpEx, leaf) {
 			return false, fmt.Errorf("Mtp0 at lvl %v doesn't match with the root", i)
 		}
 
@@ -144,7 +144,7 @@ func VerifyProofClaim(operationalPk *babyjub.PublicKey, pc *ProofClaim) (bool, e
 		}
 		claimType, claimVer := GetClaimTypeVersionFromData(&leafNext.Data)
 		SetClaimTypeVersionInData(&leafNext.Data, claimType, claimVer+1)
-		if !merkletree.VerifyProof(rootKey, mtpNoEx, leafNext.HIndex(), leafNext.HValue()) {
+		if !merkletree.VerifyProofEntry(rootKey, mtpNoEx, leafNext) {
 			return false, fmt.Errorf("Mtp1 at lvl %v doesn't match with the root", i)
 		}
 
@@ -178,7 +178,7 @@ func GetNonRevocationMTProof(mt *merkletree.MerkleTree, leafData *merkletree.Dat
 	entry := merkletree.Entry{
 		Data: *leafDataCpy,
 	}
-	proof, err := mt.GenerateProof(entry.HIndex(), nil)
+	proof, err := mt.GenerateProof(mt.HIndex(&entry), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +319,7 @@ func GetPredicateProof(mt *merkletree.MerkleTree, oldRoot, hi *merkletree.Hash)
 		if err != nil {
 			return nil, err
 		}
-		mtpExistPrevVersion, err = mt.GenerateProof(entryPrevVersion.HIndex(), oldRoot)
+		mtpExistPrevVersion, err = mt.GenerateProof(mt.HIndex(entryPrevVersion), oldRoot)
 		if err != nil {
 			return nil, err
 		}
@@ -366,7 +366,7 @@ func VerifyPredicateProof(p *PredicateProof) bool {
 		// should be a proof of non existence, if not, verification fails
 		return false
 	}
-	if !merkletree.VerifyProof(p.OldRoot, p.MtpNonExistInOldRoot, p.LeafEntry.HIndex(), p.LeafEntry.HValue()) {
+	if !merkletree.VerifyProofEntry(p.OldRoot, p.MtpNonExistInOldRoot, p.LeafEntry) {
 		return false
 	}
 
@@ -375,7 +375,7 @@ func VerifyPredicateProof(p *PredicateProof) bool {
 		// should be a proof of existence, if not, verification fails
 		return false
 	}
-	if !merkletree.VerifyProof(p.Root, p.MtpExist, p.LeafEntry.HIndex(), p.LeafEntry.HValue()) {
+	if !merkletree.VerifyProofEntry(p.Root, p.MtpExist, p.LeafEntry) {
 		return false
 	}
 
@@ -385,7 +385,7 @@ func VerifyPredicateProof(p *PredicateProof) bool {
 		return false
 	}
 	entry1 := GetNextVersionEntry(p.LeafEntry)
-	if !merkletree.VerifyProof(p.Root, p.MtpNonExistNextVersion, entry1.HIndex(), entry1.HValue()) {
+	if !merkletree.VerifyProofEntry(p.Root, p.MtpNonExistNextVersion, entry1) {
 		return false
 	}
 
@@ -406,7 +406,7 @@ func VerifyPredicateProof(p *PredicateProof) bool {
 		// if err!=nil means that there is no previous version possible, as the current version is 0
 		return false
 	}
-	if !merkletree.VerifyProof(p.OldRoot, p.MtpExistPreviousVersion, entryPrevVersion.HIndex(), entryPrevVersion.HValue()) {
+	if !merkletree.VerifyProofEntry(p.OldRoot, p.MtpExistPreviousVersion, entryPrevVersion) {
 		return false
 	}
 
@@ -13,7 +13,3 @@ func (l *LevelDbStorage) RawDump() error {
 	iter.Release()
 	return nil
 }
-
-func IPFSexport() error {
-	return nil
-}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the bucket where all the keys of a BoltStorage are stored.
+// The prefix views of the storage are mapped to key prefixes in it.
+var boltBucket = []byte("iden3")
+
+type BoltStorage struct {
+	bdb    *bolt.DB
+	prefix []byte
+}
+
+// BoltStorageTx is the Tx of a BoltStorage, which applies its changes in a
+// single bolt read-write transaction when it's commited (see bufferedTx).
+type BoltStorageTx struct {
+	bufferedTx
+	bdb *bolt.DB
+}
+
+// NewBoltStorage opens the bbolt database in the file at path, creating it if
+// it doesn't exist unless errorIfMissing is true.
+func NewBoltStorage(path string, errorIfMissing bool) (*BoltStorage, error) {
+	if errorIfMissing {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	bdb, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := bdb.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		bdb.Close()
+		return nil, err
+	}
+	return &BoltStorage{bdb, []byte{}}, nil
+}
+
+func (b *BoltStorage) Info() string {
+	keycount := 0
+	claimcount := 0
+	err := b.Iterate(func(k, v []byte) (bool, error) {
+		if len(v) > 0 && v[0] == byte(1) { // TODO when the new merkletree version is ready, instead of byte(1) use the type indicator
+			claimcount++
+		}
+		keycount++
+		return true, nil
+	})
+	if err != nil {
+		return err.Error()
+	}
+	json, _ := json.MarshalIndent(
+		storageInfo{
+			KeyCount:   keycount,
+			ClaimCount: claimcount,
+		},
+		"", "  ",
+	)
+	return string(json)
+}
+
+func (b *BoltStorage) WithPrefix(prefix []byte) Storage {
+	return &BoltStorage{b.bdb, concat(b.prefix, prefix)}
+}
+
+func (b *BoltStorage) NewTx() (Tx, error) {
+	return &BoltStorageTx{newBufferedTx(b.prefix, b.Get), b.bdb}, nil
+}
+
+// boltGet returns a copy of the value of the key in the bucket, which is only
+// valid during the bolt transaction.
+func boltGet(bucket *bolt.Bucket, key []byte) ([]byte, error) {
+	// A cursor distinguishes an empty value from a missing key
+	k, v := bucket.Cursor().Seek(key)
+	if k == nil || !bytes.Equal(k, key) {
+		return nil, ErrNotFound
+	}
+	return clone(v), nil
+}
+
+// Get retreives a value from a key in the bbolt database
+func (b *BoltStorage) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := b.bdb.View(func(btx *bolt.Tx) error {
+		var err error
+		value, err = boltGet(btx.Bucket(boltBucket), concat(b.prefix, key))
+		return err
+	})
+	return value, err
+}
+
+func (b *BoltStorage) Iterate(f func([]byte, []byte) (bool, error)) error {
+	return b.IterateRange(nil, f)
+}
+
+func (b *BoltStorage) IterateRange(opts *IterOptions, f func([]byte, []byte) (bool, error)) error {
+	start, end := opts.bounds()
+	fullStart := concat(b.prefix, start)
+	var fullEnd []byte
+	if end != nil {
+		fullEnd = concat(b.prefix, end)
+	} else {
+		fullEnd = prefixEnd(b.prefix)
+	}
+	return b.bdb.View(func(btx *bolt.Tx) error {
+		c := btx.Bucket(boltBucket).Cursor()
+		var k, v []byte
+		next := c.Next
+		if opts.reverse() {
+			// Position the cursor at the last key before the end
+			next = c.Prev
+			if fullEnd == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(fullEnd); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		} else {
+			k, v = c.Seek(fullStart)
+		}
+		for ; k != nil; k, v = next() {
+			if bytes.Compare(k, fullStart) < 0 || fullEnd != nil && bytes.Compare(k, fullEnd) >= 0 {
+				break
+			}
+			// The slices of bolt are only valid during the transaction
+			if cont, err := f(clone(k[len(b.prefix):]), clone(v)); err != nil {
+				return err
+			} else if !cont {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltStorage) ListRange(opts *IterOptions, limit int) ([]KV, []byte, error) {
+	return listRange(b, opts, limit)
+}
+
+func (tx *BoltStorageTx) Add(atx Tx) {
+	tx.add(&atx.(*BoltStorageTx).bufferedTx)
+}
+
+func (tx *BoltStorageTx) Commit() error {
+	deleted, cache := tx.take()
+	return tx.bdb.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(boltBucket)
+		for _, v := range deleted {
+			if err := bucket.Delete(v.K); err != nil {
+				return err
+			}
+		}
+		for _, v := range cache {
+			if err := bucket.Put(v.K, v.V); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltStorage) Close() {
+	if err := b.bdb.Close(); err != nil {
+		panic(err)
+	}
+	log.Info("Database closed")
+}
+
+func (b *BoltStorage) Bolt() *bolt.DB {
+	return b.bdb
+}
+
+func (b *BoltStorage) List(limit int) ([]KV, error) {
+	ret := []KV{}
+	err := b.Iterate(func(key []byte, value []byte) (bool, error) {
+		ret = append(ret, KV{key, value})
+		if len(ret) == limit {
+			return false, nil
+		}
+		return true, nil
+	})
+	return ret, err
+}
@@ -0,0 +1,370 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The archives written by IPFSexport are CARv1 archives
+// (https://ipld.io/specs/transport/car/carv1/): a header with the CID of the
+// root block, followed by sections with the CID and the data of each block,
+// all prefixed by their length as a varint.  Each block is the DAG-CBOR map
+// {"links": [CID, ...], "value": bytes} with the value of a key of the
+// storage and the links to the blocks of the keys it references, and its CID
+// is a CIDv1 with the sha2-256 of the block, so that the archive can be
+// imported into IPFS as it is.
+
+const (
+	// carMaxSectionLen is the maximum length of a section of an archive
+	// that IPFSimport accepts.
+	carMaxSectionLen = 1 << 20
+	// cidVersion, cidCodecDagCbor, multihashSha256 and multihashSha256Len
+	// are the prefix of the CIDs of the blocks.
+	cidVersion         = 0x01
+	cidCodecDagCbor    = 0x71
+	multihashSha256    = 0x12
+	multihashSha256Len = sha256.Size
+	// cidLen is the length of the CIDs of the blocks.
+	cidLen = 4 + sha256.Size
+	// cborTagCID is the CBOR tag of the CID links in DAG-CBOR.
+	cborTagCID = 42
+)
+
+var (
+	// ErrInvalidCAR is used when an archive read by IPFSimport is
+	// malformed or is not supported.
+	ErrInvalidCAR = errors.New("invalid CAR archive")
+	// ErrCARBlockMismatch is used when the data of a block of an archive
+	// doesn't match its CID.
+	ErrCARBlockMismatch = errors.New("the CAR block doesn't match its CID")
+	// ErrCARBlockNotFound is used when a block linked from the root of an
+	// archive is not in it.
+	ErrCARBlockNotFound = errors.New("CAR block not found")
+)
+
+// blockCID returns the CID of the block.
+func blockCID(block []byte) []byte {
+	h := sha256.Sum256(block)
+	return append([]byte{cidVersion, cidCodecDagCbor, multihashSha256, multihashSha256Len}, h[:]...)
+}
+
+// cborHead returns the head of a CBOR data item of the major type with the
+// argument n.
+func cborHead(major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n <= 0xff:
+		return []byte{major | 24, byte(n)}
+	case n <= 0xffff:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	case n <= 0xffffffff:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	default:
+		b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[1:], n)
+		return b
+	}
+}
+
+// cborText returns the CBOR encoding of the text string s.
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborBytes returns the CBOR encoding of the byte string b.
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+// cborCIDs returns the DAG-CBOR encoding of an array of links to the cids.
+func cborCIDs(cids [][]byte) []byte {
+	b := cborHead(4, uint64(len(cids)))
+	for _, cid := range cids {
+		b = append(b, cborHead(6, cborTagCID)...)
+		// The CIDs are prefixed by the multibase identity prefix
+		b = append(b, cborBytes(append([]byte{0x00}, cid...))...)
+	}
+	return b
+}
+
+// cborReader decodes the CBOR data items used in the archives.
+type cborReader struct {
+	b   []byte
+	err error
+}
+
+// head reads the head of a data item of the major type, returning its
+// argument.
+func (r *cborReader) head(major byte) uint64 {
+	if r.err != nil || len(r.b) == 0 || r.b[0]>>5 != major {
+		r.err = ErrInvalidCAR
+		return 0
+	}
+	info := r.b[0] & 0x1f
+	r.b = r.b[1:]
+	if info < 24 {
+		return uint64(info)
+	}
+	n := 1 << (info - 24)
+	if info > 27 || len(r.b) < n {
+		r.err = ErrInvalidCAR
+		return 0
+	}
+	var v uint64
+	for _, c := range r.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// bytes reads a byte string (major type 2) or a text string (major type 3).
+func (r *cborReader) bytes(major byte) []byte {
+	n := r.head(major)
+	if r.err != nil || uint64(len(r.b)) < n {
+		r.err = ErrInvalidCAR
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// text reads the text string s.
+func (r *cborReader) text(s string) {
+	if t := r.bytes(3); r.err == nil && string(t) != s {
+		r.err = ErrInvalidCAR
+	}
+}
+
+// cids reads an array of links to CIDs.
+func (r *cborReader) cids() [][]byte {
+	n := r.head(4)
+	if r.err != nil || n > uint64(len(r.b)) {
+		r.err = ErrInvalidCAR
+		return nil
+	}
+	cids := make([][]byte, n)
+	for i := range cids {
+		if r.head(6) != cborTagCID {
+			r.err = ErrInvalidCAR
+		}
+		cid := r.bytes(2)
+		if r.err != nil || len(cid) == 0 || cid[0] != 0x00 {
+			r.err = ErrInvalidCAR
+			return nil
+		}
+		cids[i] = cid[1:]
+	}
+	return cids
+}
+
+// end checks that all the input has been read.
+func (r *cborReader) end() error {
+	if r.err == nil && len(r.b) != 0 {
+		r.err = ErrInvalidCAR
+	}
+	return r.err
+}
+
+// encodeBlock returns the block with the value and the links.
+func encodeBlock(value []byte, links [][]byte) []byte {
+	b := cborHead(5, 2)
+	b = append(b, cborText("links")...)
+	b = append(b, cborCIDs(links)...)
+	b = append(b, cborText("value")...)
+	return append(b, cborBytes(value)...)
+}
+
+// decodeBlock returns the value and the links of the block.
+func decodeBlock(block []byte) ([]byte, [][]byte, error) {
+	r := cborReader{b: block}
+	if r.head(5) != 2 {
+		return nil, nil, ErrInvalidCAR
+	}
+	r.text("links")
+	links := r.cids()
+	r.text("value")
+	value := r.bytes(2)
+	return value, links, r.end()
+}
+
+// writeSection writes a section of an archive with the parts.
+func writeSection(w io.Writer, parts ...[]byte) error {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	var varint [binary.MaxVarintLen64]byte
+	if _, err := w.Write(varint[:binary.PutUvarint(varint[:], uint64(n))]); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSection reads a section of an archive, returning io.EOF if there are no
+// more sections.
+func readSection(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, ErrInvalidCAR
+	}
+	if n > carMaxSectionLen {
+		return nil, ErrInvalidCAR
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrInvalidCAR
+	}
+	return b, nil
+}
+
+// IPFSexport writes to w a CARv1 archive with the values reachable from the
+// rootKey as content-addressed blocks, where the root block is the root of the
+// archive.  get returns the value of a key and the keys of the values it
+// references.  All the blocks are kept in memory until they are written, as
+// the CID of the root is written first but depends on all the others, so it's
+// only suitable for values that fit in memory (like the tree of a relay).
+func IPFSexport(w io.Writer, rootKey []byte, get func(key []byte) ([]byte, [][]byte, error)) error {
+	// The CIDs of the blocks depend on the CIDs of the blocks they link to,
+	// so the blocks are built from the leafs up and written afterwards in
+	// the reverse order, with the root first.
+	blocks := make(map[string][]byte)
+	cids := make(map[string][]byte)
+	var order [][]byte
+	var build func(key []byte) ([]byte, error)
+	build = func(key []byte) ([]byte, error) {
+		if cid, ok := cids[string(key)]; ok {
+			return cid, nil
+		}
+		value, linkKeys, err := get(key)
+		if err != nil {
+			return nil, err
+		}
+		links := make([][]byte, len(linkKeys))
+		for i, linkKey := range linkKeys {
+			if links[i], err = build(linkKey); err != nil {
+				return nil, err
+			}
+		}
+		block := encodeBlock(value, links)
+		cid := blockCID(block)
+		cids[string(key)] = cid
+		blocks[string(cid)] = block
+		order = append(order, cid)
+		return cid, nil
+	}
+	rootCID, err := build(rootKey)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	header := cborHead(5, 2)
+	header = append(header, cborText("roots")...)
+	header = append(header, cborCIDs([][]byte{rootCID})...)
+	header = append(header, cborText("version")...)
+	header = append(header, cborHead(0, 1)...)
+	if err := writeSection(bw, header); err != nil {
+		return err
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := writeSection(bw, order[i], blocks[string(order[i])]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// IPFSimport reads a CARv1 archive written by IPFSexport, verifying that every
+// block matches its CID, and calls add with the value of each block reachable
+// from the root of the archive and the keys returned by add for the blocks it
+// links to, which are added before.  add returns the key of the value, or an
+// error if the value doesn't reference the linked keys.  The key of the root
+// is returned.  Like IPFSexport, all the blocks are kept in memory.
+func IPFSimport(r io.Reader, add func(value []byte, links [][]byte) ([]byte, error)) ([]byte, error) {
+	br := bufio.NewReader(r)
+	header, err := readSection(br)
+	if err == io.EOF {
+		return nil, ErrInvalidCAR
+	} else if err != nil {
+		return nil, err
+	}
+	hr := cborReader{b: header}
+	if hr.head(5) != 2 {
+		return nil, ErrInvalidCAR
+	}
+	hr.text("roots")
+	roots := hr.cids()
+	hr.text("version")
+	if version := hr.head(0); version != 1 || len(roots) != 1 {
+		return nil, ErrInvalidCAR
+	}
+	if err := hr.end(); err != nil {
+		return nil, err
+	}
+
+	blocks := make(map[string][]byte)
+	for {
+		section, err := readSection(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(section) < cidLen {
+			return nil, ErrInvalidCAR
+		}
+		cid, block := section[:cidLen], section[cidLen:]
+		if !bytes.Equal(cid, blockCID(block)) {
+			return nil, ErrCARBlockMismatch
+		}
+		blocks[string(cid)] = block
+	}
+
+	keys := make(map[string][]byte)
+	var load func(cid []byte) ([]byte, error)
+	load = func(cid []byte) ([]byte, error) {
+		if key, ok := keys[string(cid)]; ok {
+			return key, nil
+		}
+		block, ok := blocks[string(cid)]
+		if !ok {
+			return nil, ErrCARBlockNotFound
+		}
+		value, links, err := decodeBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		linkKeys := make([][]byte, len(links))
+		for i, link := range links {
+			if linkKeys[i], err = load(link); err != nil {
+				return nil, err
+			}
+		}
+		key, err := add(value, linkKeys)
+		if err != nil {
+			return nil, err
+		}
+		keys[string(cid)] = key
+		return key, nil
+	}
+	return load(roots[0])
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"bytes"
+)
+
+// IterOptions bounds and orders the iteration of a Storage with IterateRange
+// and ListRange.  All the keys are relative to the prefix of the Storage.
+type IterOptions struct {
+	// Start is the first key of the iteration, or where it seeks to if
+	// the key doesn't exist.  If nil, the iteration starts at the first
+	// key.
+	Start []byte
+	// End is the key where the iteration ends, which is not included.  If
+	// nil, the iteration ends after the last key.
+	End []byte
+	// Prefix limits the iteration to the keys that start with it.
+	Prefix []byte
+	// Reverse iterates the keys in descending order.
+	Reverse bool
+	// Cursor is the last key of a previous iteration with the same options,
+	// which continues after it (or before it if Reverse).
+	Cursor []byte
+}
+
+// prefixEnd returns the first key after all the keys with the prefix, or nil
+// if there is none.
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			end := clone(prefix[:i+1])
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+// maxKey returns the greatest of the lower bounds a and b.
+func maxKey(a, b []byte) []byte {
+	if bytes.Compare(a, b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// minEnd returns the lowest of the upper bounds a and b, where nil is no
+// bound.
+func minEnd(a, b []byte) []byte {
+	if a == nil {
+		return b
+	} else if b == nil || bytes.Compare(a, b) < 0 {
+		return a
+	}
+	return b
+}
+
+// bounds returns the first key of the iteration and the key where it ends
+// (not included), which is nil if there is no upper bound.
+func (o *IterOptions) bounds() ([]byte, []byte) {
+	if o == nil {
+		return []byte{}, nil
+	}
+	start := maxKey(o.Start, o.Prefix)
+	end := o.End
+	if len(o.Prefix) > 0 {
+		end = minEnd(end, prefixEnd(o.Prefix))
+	}
+	if o.Cursor != nil {
+		if o.Reverse {
+			end = minEnd(end, o.Cursor)
+		} else {
+			// The key after the cursor is the cursor followed by 0
+			start = maxKey(start, concat(o.Cursor, []byte{0}))
+		}
+	}
+	if start == nil {
+		start = []byte{}
+	}
+	return start, end
+}
+
+// reverse returns true if the iteration is in descending order.
+func (o *IterOptions) reverse() bool {
+	return o != nil && o.Reverse
+}
+
+// listRange returns up to limit keys and values of the iteration of sto with
+// opts (or all of them if limit is 0), and the cursor to continue the
+// iteration, which is nil if there are no more keys.
+func listRange(sto Storage, opts *IterOptions, limit int) ([]KV, []byte, error) {
+	ret := []KV{}
+	var cursor []byte
+	err := sto.IterateRange(opts, func(key []byte, value []byte) (bool, error) {
+		if len(ret) == limit && limit != 0 {
+			// There are more keys after the last one
+			cursor = clone(ret[len(ret)-1].K)
+			return false, nil
+		}
+		ret = append(ret, KV{clone(key), clone(value)})
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ret, cursor, nil
+}
@@ -13,3 +13,79 @@ func (m kvMap) Get(k []byte) ([]byte, bool) {
 func (m kvMap) Put(k, v []byte) {
 	m[sha256.Sum256(k)] = KV{k, v}
 }
+func (m kvMap) Delete(k []byte) {
+	delete(m, sha256.Sum256(k))
+}
+
+// bufferedTx accumulates the changes of a Tx in memory, like
+// LevelDbStorageTx, for the storages whose Tx applies them in a single
+// transaction of their database when it's commited (BoltStorageTx and
+// SQLStorageTx).  The Tx doesn't hold a transaction of the database while
+// it's open, because the users of a Tx can keep several of them open at the
+// same time in the same goroutine and concatenate them with Add, while bolt
+// and SQLite allow only one writing transaction at a time, which would
+// deadlock.  So the commit is atomic, but the Tx is not isolated: Get returns
+// the changes of the Tx over the current state of the database, which may
+// include the changes of other Txs commited since it was created.
+type bufferedTx struct {
+	prefix  []byte
+	cache   kvMap
+	deleted kvMap
+	// get returns the value of a key from the storage, without the prefix.
+	get func(key []byte) ([]byte, error)
+}
+
+func newBufferedTx(prefix []byte, get func(key []byte) ([]byte, error)) bufferedTx {
+	return bufferedTx{prefix, make(kvMap), make(kvMap), get}
+}
+
+// Get retreives a value from a key in the tx or the storage
+func (tx *bufferedTx) Get(key []byte) ([]byte, error) {
+	fullkey := concat(tx.prefix, key)
+
+	if _, ok := tx.deleted.Get(fullkey); ok {
+		return nil, ErrNotFound
+	}
+	if value, ok := tx.cache.Get(fullkey); ok {
+		return value, nil
+	}
+	return tx.get(key)
+}
+
+// Put saves a key:value in the storage when the tx is commited
+func (tx *bufferedTx) Put(k, v []byte) {
+	fullkey := concat(tx.prefix, k[:])
+	tx.deleted.Delete(fullkey)
+	tx.cache.Put(fullkey, v)
+}
+
+// Delete removes a key from the storage when the tx is commited
+func (tx *bufferedTx) Delete(k []byte) {
+	fullkey := concat(tx.prefix, k[:])
+	tx.cache.Delete(fullkey)
+	tx.deleted.Put(fullkey, nil)
+}
+
+// add adds the changes of atx to the tx.
+func (tx *bufferedTx) add(atx *bufferedTx) {
+	for _, v := range atx.deleted {
+		tx.cache.Delete(v.K)
+		tx.deleted.Put(v.K, nil)
+	}
+	for _, v := range atx.cache {
+		tx.deleted.Delete(v.K)
+		tx.cache.Put(v.K, v.V)
+	}
+}
+
+// take returns the full keys deleted and the ones put with their values in
+// the tx, to be commited, and empties it.
+func (tx *bufferedTx) take() (kvMap, kvMap) {
+	deleted, cache := tx.deleted, tx.cache
+	tx.cache, tx.deleted = nil, nil
+	return deleted, cache
+}
+
+func (tx *bufferedTx) Close() {
+	tx.cache, tx.deleted = nil, nil
+}
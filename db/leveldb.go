@@ -17,7 +17,8 @@ type LevelDbStorage struct {
 
 type LevelDbStorageTx struct {
 	*LevelDbStorage
-	cache kvMap
+	cache   kvMap
+	deleted kvMap
 }
 
 func NewLevelDbStorage(path string, errorIfMissing bool) (*LevelDbStorage, error) {
@@ -71,7 +72,7 @@ func (l *LevelDbStorage) WithPrefix(prefix []byte) Storage {
 }
 
 func (l *LevelDbStorage) NewTx() (Tx, error) {
-	return &LevelDbStorageTx{l, make(kvMap)}, nil
+	return &LevelDbStorageTx{l, make(kvMap), make(kvMap)}, nil
 }
 
 // Get retreives a value from a key in the mt.Lvl
@@ -103,12 +104,51 @@ func (l *LevelDbStorage) Iterate(f func([]byte, []byte) (bool, error)) error {
 	return iter.Error()
 }
 
+func (l *LevelDbStorage) IterateRange(opts *IterOptions, f func([]byte, []byte) (bool, error)) error {
+	start, end := opts.bounds()
+	r := &util.Range{Start: concat(l.prefix, start)}
+	if end != nil {
+		r.Limit = concat(l.prefix, end)
+	} else {
+		r.Limit = util.BytesPrefix(l.prefix).Limit
+	}
+	snapshot, err := l.ldb.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+	iter := snapshot.NewIterator(r, nil)
+	defer iter.Release()
+	ok, next := false, iter.Next
+	if opts.reverse() {
+		ok, next = iter.Last(), iter.Prev
+	} else {
+		ok = iter.First()
+	}
+	for ; ok; ok = next() {
+		localKey := iter.Key()[len(l.prefix):]
+		if cont, err := f(localKey, iter.Value()); err != nil {
+			return err
+		} else if !cont {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+func (l *LevelDbStorage) ListRange(opts *IterOptions, limit int) ([]KV, []byte, error) {
+	return listRange(l, opts, limit)
+}
+
 // Get retreives a value from a key in the mt.Lvl
 func (l *LevelDbStorageTx) Get(key []byte) ([]byte, error) {
 	var err error
 
 	fullkey := concat(l.prefix, key)
 
+	if _, ok := l.deleted.Get(fullkey); ok {
+		return nil, ErrNotFound
+	}
 	if value, ok := l.cache.Get(fullkey); ok {
 		return value, nil
 	}
@@ -123,12 +163,26 @@ func (l *LevelDbStorageTx) Get(key []byte) ([]byte, error) {
 
 // Insert saves a key:value into the mt.Lvl
 func (tx *LevelDbStorageTx) Put(k, v []byte) {
-	tx.cache.Put(concat(tx.prefix, k[:]), v)
+	fullkey := concat(tx.prefix, k[:])
+	tx.deleted.Delete(fullkey)
+	tx.cache.Put(fullkey, v)
+}
+
+// Delete removes a key from the mt.Lvl when the tx is commited
+func (tx *LevelDbStorageTx) Delete(k []byte) {
+	fullkey := concat(tx.prefix, k[:])
+	tx.cache.Delete(fullkey)
+	tx.deleted.Put(fullkey, nil)
 }
 
 func (tx *LevelDbStorageTx) Add(atx Tx) {
 	ldbtx := atx.(*LevelDbStorageTx)
+	for _, v := range ldbtx.deleted {
+		tx.cache.Delete(v.K)
+		tx.deleted.Put(v.K, nil)
+	}
 	for _, v := range ldbtx.cache {
+		tx.deleted.Delete(v.K)
 		tx.cache.Put(v.K, v.V)
 	}
 }
@@ -136,16 +190,19 @@ func (tx *LevelDbStorageTx) Add(atx Tx) {
 func (l *LevelDbStorageTx) Commit() error {
 
 	var batch leveldb.Batch
+	for _, v := range l.deleted {
+		batch.Delete(v.K)
+	}
 	for _, v := range l.cache {
 		batch.Put(v.K, v.V)
 	}
 
-	l.cache = nil
+	l.cache, l.deleted = nil, nil
 	return l.ldb.Write(&batch, nil)
 }
 
 func (l *LevelDbStorageTx) Close() {
-	l.cache = nil
+	l.cache, l.deleted = nil, nil
 }
 
 func (l *LevelDbStorage) Close() {
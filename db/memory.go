@@ -11,8 +11,9 @@ type MemoryStorage struct {
 }
 
 type MemoryStorageTx struct {
-	s  *MemoryStorage
-	kv kvMap
+	s       *MemoryStorage
+	kv      kvMap
+	deleted kvMap
 }
 
 func NewMemoryStorage() *MemoryStorage {
@@ -29,7 +30,7 @@ func (m *MemoryStorage) WithPrefix(prefix []byte) Storage {
 }
 
 func (m *MemoryStorage) NewTx() (Tx, error) {
-	return &MemoryStorageTx{m, make(kvMap)}, nil
+	return &MemoryStorageTx{m, make(kvMap), make(kvMap)}, nil
 }
 
 // Get retreives a value from a key in the mt.Lvl
@@ -63,8 +64,46 @@ func (l *MemoryStorage) Iterate(f func([]byte, []byte) (bool, error)) error {
 	return nil
 }
 
+func (l *MemoryStorage) IterateRange(opts *IterOptions, f func([]byte, []byte) (bool, error)) error {
+	start, end := opts.bounds()
+	kvs := make([]KV, 0)
+	for _, v := range l.kv {
+		if len(v.K) < len(l.prefix) || !bytes.Equal(v.K[:len(l.prefix)], l.prefix) {
+			continue
+		}
+		localkey := v.K[len(l.prefix):]
+		if bytes.Compare(localkey, start) < 0 || end != nil && bytes.Compare(localkey, end) >= 0 {
+			continue
+		}
+		kvs = append(kvs, KV{localkey, v.V})
+	}
+	reverse := opts.reverse()
+	sort.Slice(kvs, func(i, j int) bool {
+		if reverse {
+			return bytes.Compare(kvs[i].K, kvs[j].K) > 0
+		}
+		return bytes.Compare(kvs[i].K, kvs[j].K) < 0
+	})
+
+	for _, kv := range kvs {
+		if cont, err := f(kv.K, kv.V); err != nil {
+			return err
+		} else if !cont {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *MemoryStorage) ListRange(opts *IterOptions, limit int) ([]KV, []byte, error) {
+	return listRange(l, opts, limit)
+}
+
 func (tx *MemoryStorageTx) Get(key []byte) ([]byte, error) {
 
+	if _, ok := tx.deleted.Get(concat(tx.s.prefix, key)); ok {
+		return nil, ErrNotFound
+	}
 	if v, ok := tx.kv.Get(concat(tx.s.prefix, key)); ok {
 		return v, nil
 	}
@@ -76,26 +115,43 @@ func (tx *MemoryStorageTx) Get(key []byte) ([]byte, error) {
 }
 
 func (tx *MemoryStorageTx) Put(k, v []byte) {
-	tx.kv.Put(concat(tx.s.prefix, k), v)
+	fullkey := concat(tx.s.prefix, k)
+	tx.deleted.Delete(fullkey)
+	tx.kv.Put(fullkey, v)
+}
+
+// Delete removes a key from the storage when the tx is commited
+func (tx *MemoryStorageTx) Delete(k []byte) {
+	fullkey := concat(tx.s.prefix, k)
+	tx.kv.Delete(fullkey)
+	tx.deleted.Put(fullkey, nil)
 }
 
 func (tx *MemoryStorageTx) Commit() error {
+	for _, v := range tx.deleted {
+		tx.s.kv.Delete(v.K)
+	}
 	for _, v := range tx.kv {
 		tx.s.kv.Put(v.K, v.V)
 	}
-	tx.kv = nil
+	tx.kv, tx.deleted = nil, nil
 	return nil
 }
 
 func (tx *MemoryStorageTx) Add(atx Tx) {
 	mstx := atx.(*MemoryStorageTx)
+	for _, v := range mstx.deleted {
+		tx.kv.Delete(v.K)
+		tx.deleted.Put(v.K, nil)
+	}
 	for _, v := range mstx.kv {
+		tx.deleted.Delete(v.K)
 		tx.kv.Put(v.K, v.V)
 	}
 }
 
 func (tx *MemoryStorageTx) Close() {
-	tx.kv = nil
+	tx.kv, tx.deleted = nil, nil
 }
 
 func (m *MemoryStorage) Close() {
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrInvalidSQLTable is used when the name of the table of a SQLStorage is not
+// a valid SQL identifier.
+var ErrInvalidSQLTable = errors.New("invalid SQL table name")
+
+// sqlTableRegexp matches the valid names of the table of a SQLStorage, which
+// are written in the queries as they are.
+var sqlTableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqlQueries are the queries used by a SQLStorage in the SQL dialect of its
+// driver.
+type sqlQueries struct {
+	create string
+	get    string
+	put    string
+	del    string
+	// iterate are the queries of the keys and values from a key, indexed by
+	// whether they have an end key and are in descending order.
+	iterate [2][2]string
+}
+
+// newSQLQueries returns the queries of a SQLStorage with the table for the
+// driver.  Postgres uses its own bytea type and numbered placeholders, and
+// any other driver uses the SQLite ones.
+func newSQLQueries(driver, table string) sqlQueries {
+	blob, ph := "BLOB", func(i int) string { return "?" }
+	if driver == "postgres" || driver == "pgx" {
+		blob, ph = "BYTEA", func(i int) string { return fmt.Sprintf("$%d", i) }
+	}
+	q := sqlQueries{
+		create: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (k %s PRIMARY KEY, v %s NOT NULL)",
+			table, blob, blob),
+		get: fmt.Sprintf("SELECT v FROM %s WHERE k = %s", table, ph(1)),
+		put: fmt.Sprintf("INSERT INTO %s (k, v) VALUES (%s, %s) ON CONFLICT (k) DO UPDATE SET v = excluded.v",
+			table, ph(1), ph(2)),
+		del: fmt.Sprintf("DELETE FROM %s WHERE k = %s", table, ph(1)),
+	}
+	from := fmt.Sprintf("SELECT k, v FROM %s WHERE k >= %s", table, ph(1))
+	fromTo := fmt.Sprintf("%s AND k < %s", from, ph(2))
+	q.iterate = [2][2]string{
+		{from + " ORDER BY k", from + " ORDER BY k DESC"},
+		{fromTo + " ORDER BY k", fromTo + " ORDER BY k DESC"},
+	}
+	return q
+}
+
+// boolIndex returns 1 if b is true, or 0 otherwise.
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// SQLStorage is a Storage that keeps the keys and values in a table of a SQL
+// database, with the prefix views of the storage mapped to key prefixes.
+type SQLStorage struct {
+	sdb     *sql.DB
+	queries sqlQueries
+	prefix  []byte
+}
+
+// SQLStorageTx is the Tx of a SQLStorage, which applies its changes in a
+// single SQL transaction when it's commited (see bufferedTx).
+type SQLStorageTx struct {
+	bufferedTx
+	sdb     *sql.DB
+	queries sqlQueries
+}
+
+// NewSQLStorage returns a SQLStorage that uses the table in the SQL database,
+// which is created if it doesn't exist.  The driver is the one used to open
+// sdb, which determines the SQL dialect: "postgres" and "pgx" use Postgres,
+// and any other SQLite.  The database is closed with the storage.
+func NewSQLStorage(sdb *sql.DB, driver, table string) (*SQLStorage, error) {
+	if !sqlTableRegexp.MatchString(table) {
+		return nil, ErrInvalidSQLTable
+	}
+	queries := newSQLQueries(driver, table)
+	if _, err := sdb.Exec(queries.create); err != nil {
+		return nil, err
+	}
+	return &SQLStorage{sdb, queries, []byte{}}, nil
+}
+
+// nonNil returns b, or an empty slice if it's nil, which the SQL drivers
+// store as NULL.
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func (s *SQLStorage) Info() string {
+	keycount := 0
+	claimcount := 0
+	err := s.Iterate(func(k, v []byte) (bool, error) {
+		if len(v) > 0 && v[0] == byte(1) { // TODO when the new merkletree version is ready, instead of byte(1) use the type indicator
+			claimcount++
+		}
+		keycount++
+		return true, nil
+	})
+	if err != nil {
+		return err.Error()
+	}
+	json, _ := json.MarshalIndent(
+		storageInfo{
+			KeyCount:   keycount,
+			ClaimCount: claimcount,
+		},
+		"", "  ",
+	)
+	return string(json)
+}
+
+func (s *SQLStorage) WithPrefix(prefix []byte) Storage {
+	return &SQLStorage{s.sdb, s.queries, concat(s.prefix, prefix)}
+}
+
+func (s *SQLStorage) NewTx() (Tx, error) {
+	return &SQLStorageTx{newBufferedTx(s.prefix, s.Get), s.sdb, s.queries}, nil
+}
+
+// Get retreives a value from a key in the SQL table
+func (s *SQLStorage) Get(key []byte) ([]byte, error) {
+	var v []byte
+	err := s.sdb.QueryRow(s.queries.get, nonNil(concat(s.prefix, key))).Scan(&v)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return nonNil(v), nil
+}
+
+func (s *SQLStorage) Iterate(f func([]byte, []byte) (bool, error)) error {
+	return s.IterateRange(nil, f)
+}
+
+func (s *SQLStorage) IterateRange(opts *IterOptions, f func([]byte, []byte) (bool, error)) error {
+	start, end := opts.bounds()
+	args := []interface{}{nonNil(concat(s.prefix, start))}
+	if end != nil {
+		args = append(args, concat(s.prefix, end))
+	} else if end = prefixEnd(s.prefix); end != nil {
+		args = append(args, end)
+	}
+	query := s.queries.iterate[boolIndex(len(args) == 2)][boolIndex(opts.reverse())]
+	rows, err := s.sdb.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if cont, err := f(k[len(s.prefix):], nonNil(v)); err != nil {
+			return err
+		} else if !cont {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLStorage) ListRange(opts *IterOptions, limit int) ([]KV, []byte, error) {
+	return listRange(s, opts, limit)
+}
+
+func (tx *SQLStorageTx) Add(atx Tx) {
+	tx.add(&atx.(*SQLStorageTx).bufferedTx)
+}
+
+// sqlExec executes the query with each of the kvs in the SQL transaction, with
+// their values if withValues is true.
+func sqlExec(stx *sql.Tx, query string, kvs kvMap, withValues bool) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	stmt, err := stx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, v := range kvs {
+		args := []interface{}{nonNil(v.K)}
+		if withValues {
+			args = append(args, nonNil(v.V))
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *SQLStorageTx) Commit() error {
+	deleted, cache := tx.take()
+	stx, err := tx.sdb.Begin()
+	if err != nil {
+		return err
+	}
+	if err := sqlExec(stx, tx.queries.del, deleted, false); err != nil {
+		stx.Rollback()
+		return err
+	}
+	if err := sqlExec(stx, tx.queries.put, cache, true); err != nil {
+		stx.Rollback()
+		return err
+	}
+	return stx.Commit()
+}
+
+func (s *SQLStorage) Close() {
+	if err := s.sdb.Close(); err != nil {
+		panic(err)
+	}
+	log.Info("Database closed")
+}
+
+func (s *SQLStorage) SQL() *sql.DB {
+	return s.sdb
+}
+
+func (s *SQLStorage) List(limit int) ([]KV, error) {
+	ret := []KV{}
+	err := s.Iterate(func(key []byte, value []byte) (bool, error) {
+		ret = append(ret, KV{clone(key), clone(value)})
+		if len(ret) == limit {
+			return false, nil
+		}
+		return true, nil
+	})
+	return ret, err
+}
@@ -19,11 +19,20 @@ type Storage interface {
 	Close()
 	Info() string
 	Iterate(func([]byte, []byte) (bool, error)) error
+	// IterateRange calls f with each key and value in the range of opts
+	// (or all of them if opts is nil) in order, until f returns false or
+	// an error.
+	IterateRange(opts *IterOptions, f func([]byte, []byte) (bool, error)) error
+	// ListRange returns up to limit keys and values in the range of opts
+	// (or all of them if limit is 0), and the cursor to continue with
+	// the next ones, which is nil if there are no more.
+	ListRange(opts *IterOptions, limit int) ([]KV, []byte, error)
 }
 
 type Tx interface {
 	Get([]byte) ([]byte, error)
 	Put(k, v []byte)
+	Delete(k []byte)
 	Add(Tx)
 	Commit() error
 	Close()
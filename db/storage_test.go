@@ -1,10 +1,14 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +29,41 @@ func levelDbStorage(t *testing.T) Storage {
 	return sto
 }
 
+func boltStorage(t *testing.T) Storage {
+	dir, err := ioutil.TempDir("", "db")
+	rmDirs = append(rmDirs, dir)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	sto, err := NewBoltStorage(filepath.Join(dir, "bolt.db"), false)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return sto
+}
+
+func sqlStorage(t *testing.T) Storage {
+	dir, err := ioutil.TempDir("", "db")
+	rmDirs = append(rmDirs, dir)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	sdb, err := sql.Open("sqlite3", filepath.Join(dir, "sql.db"))
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	sto, err := NewSQLStorage(sdb, "sqlite3", "kv")
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return sto
+}
+
 func testReturnKnownErrIfNotExists(t *testing.T, sto Storage) {
 	k := []byte("key")
 
@@ -191,6 +230,269 @@ func testList(t *testing.T, sto Storage) {
 
 }
 
+func testDelete(t *testing.T, sto Storage) {
+	k1, k2 := []byte("key1"), []byte("key2")
+
+	tx, err := sto.NewTx()
+	assert.Nil(t, err)
+	tx.Put(k1, []byte{1})
+	tx.Put(k2, []byte{2})
+	assert.Nil(t, tx.Commit())
+
+	// the deletion is only visible within the tx until it's commited
+	tx, err = sto.NewTx()
+	assert.Nil(t, err)
+	tx.Delete(k1)
+	_, err = tx.Get(k1)
+	assert.Equal(t, ErrNotFound, err)
+	v, err := sto.Get(k1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, v)
+	assert.Nil(t, tx.Commit())
+
+	_, err = sto.Get(k1)
+	assert.Equal(t, ErrNotFound, err)
+	v, err = sto.Get(k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, v)
+
+	// a deleted key can be put again, and a put key deleted, in the same tx
+	tx, err = sto.NewTx()
+	assert.Nil(t, err)
+	tx.Delete(k2)
+	tx.Put(k2, []byte{3})
+	tx.Put(k1, []byte{4})
+	tx.Delete(k1)
+	assert.Nil(t, tx.Commit())
+	_, err = sto.Get(k1)
+	assert.Equal(t, ErrNotFound, err)
+	v, err = sto.Get(k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3}, v)
+
+	// a closed tx doesn't delete anything
+	tx, err = sto.NewTx()
+	assert.Nil(t, err)
+	tx.Delete(k2)
+	tx.Close()
+	v, err = sto.Get(k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3}, v)
+
+	// deleting a missing key is not an error
+	tx, err = sto.NewTx()
+	assert.Nil(t, err)
+	tx.Delete([]byte("missing"))
+	assert.Nil(t, tx.Commit())
+
+	kvs, err := sto.List(100)
+	assert.Nil(t, err)
+	assert.Equal(t, []KV{{k2, []byte{3}}}, kvs)
+}
+
+func testDeleteWithPrefix(t *testing.T, sto Storage) {
+	k := []byte{9}
+
+	sto1 := sto.WithPrefix([]byte{1})
+	sto2 := sto.WithPrefix([]byte{2})
+
+	tx, err := sto.NewTx()
+	assert.Nil(t, err)
+	tx.Put(append([]byte{1}, k...), []byte{4, 5, 6})
+	tx.Put(append([]byte{2}, k...), []byte{8, 9})
+	assert.Nil(t, tx.Commit())
+
+	sto1tx, err := sto1.NewTx()
+	assert.Nil(t, err)
+	sto1tx.Delete(k)
+	assert.Nil(t, sto1tx.Commit())
+
+	_, err = sto1.Get(k)
+	assert.Equal(t, ErrNotFound, err)
+	v2, err := sto2.Get(k)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{8, 9}, v2)
+	_, err = sto.Get(append([]byte{1}, k...))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func testConcatTxDelete(t *testing.T, sto Storage) {
+	k := []byte{9}
+
+	sto1 := sto.WithPrefix([]byte{1})
+	sto2 := sto.WithPrefix([]byte{2})
+
+	tx, err := sto.NewTx()
+	assert.Nil(t, err)
+	tx.Put(append([]byte{1}, k...), []byte{4, 5, 6})
+	tx.Put(append([]byte{2}, k...), []byte{8, 9})
+	assert.Nil(t, tx.Commit())
+
+	// the deletion of the added tx is applied
+	sto1tx, err := sto1.NewTx()
+	assert.Nil(t, err)
+	sto1tx.Put([]byte{10}, []byte{1})
+	sto2tx, err := sto2.NewTx()
+	assert.Nil(t, err)
+	sto2tx.Delete(k)
+	sto1tx.Add(sto2tx)
+	assert.Nil(t, sto1tx.Commit())
+
+	_, err = sto2.Get(k)
+	assert.Equal(t, ErrNotFound, err)
+	v1, err := sto1.Get(k)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 5, 6}, v1)
+	v1, err = sto1.Get([]byte{10})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, v1)
+
+	// the added tx overrides the deletions and puts of the same keys
+	sto1tx, err = sto1.NewTx()
+	assert.Nil(t, err)
+	sto1tx.Delete(k)
+	sto1tx.Put([]byte{10}, []byte{2})
+	sto1tx2, err := sto1.NewTx()
+	assert.Nil(t, err)
+	sto1tx2.Put(k, []byte{7})
+	sto1tx2.Delete([]byte{10})
+	sto1tx.Add(sto1tx2)
+	v1, err = sto1tx.Get(k)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{7}, v1)
+	_, err = sto1tx.Get([]byte{10})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, sto1tx.Commit())
+
+	v1, err = sto1.Get(k)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{7}, v1)
+	_, err = sto1.Get([]byte{10})
+	assert.Equal(t, ErrNotFound, err)
+}
+
+// keys returns the keys of the kvs.
+func keys(kvs []KV) [][]byte {
+	ks := [][]byte{}
+	for _, kv := range kvs {
+		ks = append(ks, kv.K)
+	}
+	return ks
+}
+
+func testIterateRange(t *testing.T, sto Storage) {
+	sto1 := sto.WithPrefix([]byte{1})
+	kvs, cursor, err := sto1.ListRange(nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(kvs))
+	assert.Nil(t, cursor)
+
+	tx, _ := sto1.NewTx()
+	for _, k := range [][]byte{{1}, {1, 1}, {1, 2}, {2}, {2, 0}, {3}, {0xff}, {0xff, 0xff}} {
+		tx.Put(k, append([]byte{9}, k...))
+	}
+	assert.Nil(t, tx.Commit())
+	// keys out of the prefix of the storage
+	tx, _ = sto.NewTx()
+	tx.Put([]byte{0, 5}, []byte{5})
+	tx.Put([]byte{2, 0}, []byte{6})
+	assert.Nil(t, tx.Commit())
+
+	all := [][]byte{{1}, {1, 1}, {1, 2}, {2}, {2, 0}, {3}, {0xff}, {0xff, 0xff}}
+	var tests = []struct {
+		opts     *IterOptions
+		expected [][]byte
+	}{
+		{nil, all},
+		{&IterOptions{}, all},
+		{&IterOptions{Start: []byte{1, 1}, End: []byte{3}}, [][]byte{{1, 1}, {1, 2}, {2}, {2, 0}}},
+		{&IterOptions{Start: []byte{1, 5}}, [][]byte{{2}, {2, 0}, {3}, {0xff}, {0xff, 0xff}}},
+		{&IterOptions{End: []byte{2}}, [][]byte{{1}, {1, 1}, {1, 2}}},
+		{&IterOptions{Prefix: []byte{1}}, [][]byte{{1}, {1, 1}, {1, 2}}},
+		{&IterOptions{Prefix: []byte{0xff}}, [][]byte{{0xff}, {0xff, 0xff}}},
+		{&IterOptions{Prefix: []byte{1}, Start: []byte{1, 2}}, [][]byte{{1, 2}}},
+		{&IterOptions{Prefix: []byte{4}}, [][]byte{}},
+		{&IterOptions{Reverse: true, Start: []byte{1, 2}, End: []byte{0xff}},
+			[][]byte{{3}, {2, 0}, {2}, {1, 2}}},
+		{&IterOptions{Reverse: true, Prefix: []byte{2}}, [][]byte{{2, 0}, {2}}},
+		{&IterOptions{Cursor: []byte{2}}, [][]byte{{2, 0}, {3}, {0xff}, {0xff, 0xff}}},
+		{&IterOptions{Reverse: true, Cursor: []byte{2}}, [][]byte{{1, 2}, {1, 1}, {1}}},
+	}
+	for _, test := range tests {
+		kvs, cursor, err := sto1.ListRange(test.opts, 0)
+		assert.Nil(t, err)
+		assert.Nil(t, cursor)
+		assert.Equal(t, test.expected, keys(kvs), "%+v", test.opts)
+	}
+	kvs, _, err = sto1.ListRange(&IterOptions{Start: []byte{2}}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []KV{{[]byte{2}, []byte{9, 2}}}, kvs)
+
+	// Pages
+	for _, reverse := range []bool{false, true} {
+		opts := &IterOptions{Reverse: reverse}
+		paged := [][]byte{}
+		for {
+			kvs, cursor, err := sto1.ListRange(opts, 3)
+			assert.Nil(t, err)
+			paged = append(paged, keys(kvs)...)
+			if cursor == nil {
+				break
+			}
+			assert.Equal(t, 3, len(kvs))
+			opts.Cursor = cursor
+		}
+		expected := all
+		if reverse {
+			expected = [][]byte{}
+			for i := len(all) - 1; i >= 0; i-- {
+				expected = append(expected, all[i])
+			}
+		}
+		assert.Equal(t, expected, paged)
+	}
+
+	// Stop at the first error or false
+	n := 0
+	err = sto1.IterateRange(nil, func(k, v []byte) (bool, error) {
+		n++
+		return n < 2, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	err = sto1.IterateRange(nil, func(k, v []byte) (bool, error) {
+		return true, ErrNotFound
+	})
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestLevelDbDeletePersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sto, err := NewLevelDbStorage(dir, false)
+	assert.Nil(t, err)
+	tx, err := sto.NewTx()
+	assert.Nil(t, err)
+	tx.Put([]byte("key1"), []byte{1})
+	tx.Put([]byte("key2"), []byte{2})
+	assert.Nil(t, tx.Commit())
+	tx, err = sto.NewTx()
+	assert.Nil(t, err)
+	tx.Delete([]byte("key1"))
+	assert.Nil(t, tx.Commit())
+	sto.Close()
+
+	sto, err = NewLevelDbStorage(dir, true)
+	assert.Nil(t, err)
+	defer sto.Close()
+	_, err = sto.Get([]byte("key1"))
+	assert.Equal(t, ErrNotFound, err)
+	v, err := sto.Get([]byte("key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, v)
+}
+
 func TestLevelDb(t *testing.T) {
 	testReturnKnownErrIfNotExists(t, levelDbStorage(t))
 	testStorageInsertGet(t, levelDbStorage(t))
@@ -198,6 +500,137 @@ func TestLevelDb(t *testing.T) {
 	testConcatTx(t, levelDbStorage(t))
 	testList(t, levelDbStorage(t))
 	testIterate(t, levelDbStorage(t))
+	testDelete(t, levelDbStorage(t))
+	testDeleteWithPrefix(t, levelDbStorage(t))
+	testConcatTxDelete(t, levelDbStorage(t))
+	testIterateRange(t, levelDbStorage(t))
+}
+
+func TestBolt(t *testing.T) {
+	testReturnKnownErrIfNotExists(t, boltStorage(t))
+	testStorageInsertGet(t, boltStorage(t))
+	testStorageWithPrefix(t, boltStorage(t))
+	testConcatTx(t, boltStorage(t))
+	testList(t, boltStorage(t))
+	testIterate(t, boltStorage(t))
+	testDelete(t, boltStorage(t))
+	testDeleteWithPrefix(t, boltStorage(t))
+	testConcatTxDelete(t, boltStorage(t))
+	testIterateRange(t, boltStorage(t))
+}
+
+func TestBoltPersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bolt.db")
+	_, err = NewBoltStorage(path, true)
+	assert.NotNil(t, err)
+
+	sto, err := NewBoltStorage(path, false)
+	assert.Nil(t, err)
+	tx, err := sto.WithPrefix([]byte{1}).NewTx()
+	assert.Nil(t, err)
+	tx.Put([]byte("key1"), []byte{1})
+	tx.Put([]byte("key2"), []byte{})
+	assert.Nil(t, tx.Commit())
+	sto.Close()
+
+	sto, err = NewBoltStorage(path, true)
+	assert.Nil(t, err)
+	defer sto.Close()
+	v, err := sto.WithPrefix([]byte{1}).Get([]byte("key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, v)
+	v, err = sto.WithPrefix([]byte{1}).Get([]byte("key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(v))
+	_, err = sto.Get([]byte("key1"))
+	assert.Equal(t, ErrNotFound, err)
+
+	// The keys and values passed to the iteration belong to it
+	var kvs []KV
+	assert.Nil(t, sto.Iterate(func(k, v []byte) (bool, error) {
+		if len(v) > 0 {
+			v[0]++
+		}
+		kvs = append(kvs, KV{k, v})
+		return true, nil
+	}))
+	assert.Equal(t, []KV{{[]byte("\x01key1"), []byte{2}}, {[]byte("\x01key2"), []byte{}}}, kvs)
+	v, err = sto.WithPrefix([]byte{1}).Get([]byte("key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, v)
+
+	// The info only counts the keys of the prefix
+	tx, err = sto.WithPrefix([]byte{2}).NewTx()
+	assert.Nil(t, err)
+	tx.Put([]byte("claim"), []byte{1, 2})
+	assert.Nil(t, tx.Commit())
+	var info storageInfo
+	assert.Nil(t, json.Unmarshal([]byte(sto.WithPrefix([]byte{2}).Info()), &info))
+	assert.Equal(t, storageInfo{KeyCount: 1, ClaimCount: 1}, info)
+	assert.Nil(t, json.Unmarshal([]byte(sto.Info()), &info))
+	assert.Equal(t, storageInfo{KeyCount: 3, ClaimCount: 2}, info)
+}
+
+func TestSQL(t *testing.T) {
+	testReturnKnownErrIfNotExists(t, sqlStorage(t))
+	testStorageInsertGet(t, sqlStorage(t))
+	testStorageWithPrefix(t, sqlStorage(t))
+	testConcatTx(t, sqlStorage(t))
+	testList(t, sqlStorage(t))
+	testIterate(t, sqlStorage(t))
+	testDelete(t, sqlStorage(t))
+	testDeleteWithPrefix(t, sqlStorage(t))
+	testConcatTxDelete(t, sqlStorage(t))
+	testIterateRange(t, sqlStorage(t))
+}
+
+func TestSQLTables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sdb, err := sql.Open("sqlite3", filepath.Join(dir, "sql.db"))
+	assert.Nil(t, err)
+	defer sdb.Close()
+
+	_, err = NewSQLStorage(sdb, "sqlite3", "kv; DROP TABLE kv")
+	assert.Equal(t, ErrInvalidSQLTable, err)
+
+	// Two tables in the same database are independent, and the values
+	// remain in a table opened again
+	sto1, err := NewSQLStorage(sdb, "sqlite3", "kv1")
+	assert.Nil(t, err)
+	sto2, err := NewSQLStorage(sdb, "sqlite3", "kv2")
+	assert.Nil(t, err)
+	tx, err := sto1.NewTx()
+	assert.Nil(t, err)
+	tx.Put([]byte("key"), []byte{1})
+	tx.Put([]byte("empty"), []byte{})
+	assert.Nil(t, tx.Commit())
+	_, err = sto2.Get([]byte("key"))
+	assert.Equal(t, ErrNotFound, err)
+
+	sto1, err = NewSQLStorage(sdb, "sqlite3", "kv1")
+	assert.Nil(t, err)
+	v, err := sto1.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, v)
+	v, err = sto1.Get([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, v)
+
+	// The info only counts the keys of the prefix
+	tx, err = sto1.WithPrefix([]byte{1}).NewTx()
+	assert.Nil(t, err)
+	tx.Put([]byte("claim"), []byte{1, 2})
+	assert.Nil(t, tx.Commit())
+	var info storageInfo
+	assert.Nil(t, json.Unmarshal([]byte(sto1.WithPrefix([]byte{1}).Info()), &info))
+	assert.Equal(t, storageInfo{KeyCount: 1, ClaimCount: 1}, info)
+	assert.Nil(t, json.Unmarshal([]byte(sto1.Info()), &info))
+	assert.Equal(t, storageInfo{KeyCount: 3, ClaimCount: 2}, info)
 }
 
 func TestMemory(t *testing.T) {
@@ -207,6 +640,10 @@ func TestMemory(t *testing.T) {
 	testConcatTx(t, NewMemoryStorage())
 	testList(t, NewMemoryStorage())
 	testIterate(t, NewMemoryStorage())
+	testDelete(t, NewMemoryStorage())
+	testDeleteWithPrefix(t, NewMemoryStorage())
+	testConcatTxDelete(t, NewMemoryStorage())
+	testIterateRange(t, NewMemoryStorage())
 }
 
 func TestMain(m *testing.M) {
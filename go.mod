@@ -22,6 +22,7 @@ require (
 	github.com/ipfsconsortium/go-ipfsc v0.0.0-20190116161836-3629ecc1f76f
 	github.com/jamesruan/sodium v0.0.0-20181216154042-9620b83ffeae
 	github.com/leodido/go-urn v1.1.0 // indirect
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/pborman/uuid v1.2.0 // indirect
 	github.com/rjeczalik/notify v0.9.2 // indirect
 	github.com/rs/cors v1.6.0 // indirect
@@ -32,6 +33,7 @@ require (
 	github.com/stretchr/testify v1.3.0
 	github.com/syndtr/goleveldb v1.0.0
 	github.com/urfave/cli v1.20.0
+	go.etcd.io/bbolt v1.3.2
 	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4
 	gopkg.in/go-playground/validator.v9 v9.29.1
 	gopkg.in/mgo.v2 v2.0.0-20180705113604-9856a29383ce
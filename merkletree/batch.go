@@ -0,0 +1,218 @@
+package merkletree
+
+import (
+	"bytes"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// batchNode is a node of the in-memory tree used to insert a batch of entries.
+// The nodes that are not modified by the batch keep their key, and are only
+// loaded from the storage when the batch needs to go through them.  The keys
+// of the modified nodes are computed once all the entries have been inserted.
+type batchNode struct {
+	// key is the key of a node that has not been modified by the batch.
+	key *Hash
+	// node is the stored node with key, once it has been loaded.
+	node *Node
+	// entry is the entry of a new leaf.
+	entry *Entry
+	// childL and childR are the children of a modified middle node.
+	childL, childR *batchNode
+}
+
+// newBatchNodeKey creates a batchNode for a stored node that has not been
+// modified by the batch.
+func newBatchNodeKey(key *Hash) *batchNode {
+	return &batchNode{key: key}
+}
+
+// nodeType returns the type of node represented by the batchNode.
+func (bn *batchNode) nodeType() NodeType {
+	switch {
+	case bn.entry != nil:
+		return NodeTypeLeaf
+	case bn.childL != nil:
+		return NodeTypeMiddle
+	case bn.node != nil:
+		return bn.node.Type
+	default:
+		return NodeTypeEmpty
+	}
+}
+
+// hIndex returns the hIndex of the entry of a leaf batchNode.
+func (bn *batchNode) hIndex(hasher Hasher) *Hash {
+	if bn.entry != nil {
+		return bn.entry.HIndexHasher(hasher)
+	}
+	return bn.node.Entry.HIndexHasher(hasher)
+}
+
+// loadBatchNode loads the node of an unmodified batchNode from the storage.
+func (mt *MerkleTree) loadBatchNode(bn *batchNode) error {
+	if bn.key == nil || bn.node != nil {
+		return nil
+	}
+	n, err := mt.GetNode(bn.key)
+	if err != nil {
+		return err
+	}
+	bn.node = n
+	return nil
+}
+
+// pushBatchLeaf pushes an existing oldLeaf down until its path diverges from
+// the path of newLeaf, and returns the middle node that contains both.
+func (mt *MerkleTree) pushBatchLeaf(newLeaf *batchNode, oldLeaf *batchNode,
+	lvl int, pathNewLeaf []bool, pathOldLeaf []bool) (*batchNode, error) {
+	if lvl > mt.maxLevels-2 {
+		return nil, ErrReachedMaxLevel
+	}
+	if pathNewLeaf[lvl] == pathOldLeaf[lvl] { // We need to go deeper!
+		next, err := mt.pushBatchLeaf(newLeaf, oldLeaf, lvl+1, pathNewLeaf, pathOldLeaf)
+		if err != nil {
+			return nil, err
+		}
+		if pathNewLeaf[lvl] {
+			return &batchNode{childL: newBatchNodeKey(&HashZero), childR: next}, nil // go right
+		}
+		return &batchNode{childL: next, childR: newBatchNodeKey(&HashZero)}, nil // go left
+	}
+	if pathNewLeaf[lvl] {
+		return &batchNode{childL: oldLeaf, childR: newLeaf}, nil
+	}
+	return &batchNode{childL: newLeaf, childR: oldLeaf}, nil
+}
+
+// addBatchLeaf recursively adds newLeaf into the in-memory tree bn, returning
+// the modified tree.
+func (mt *MerkleTree) addBatchLeaf(bn *batchNode, newLeaf *batchNode,
+	lvl int, path []bool) (*batchNode, error) {
+	if lvl > mt.maxLevels-1 {
+		return nil, ErrReachedMaxLevel
+	}
+	if err := mt.loadBatchNode(bn); err != nil {
+		return nil, err
+	}
+	switch bn.nodeType() {
+	case NodeTypeEmpty:
+		return newLeaf, nil
+	case NodeTypeLeaf:
+		hIndex := bn.hIndex(mt.hasher)
+		if bytes.Equal(hIndex[:], newLeaf.entry.HIndexHasher(mt.hasher)[:]) {
+			return nil, ErrEntryIndexAlreadyExists
+		}
+		pathOldLeaf := getPath(mt.maxLevels, hIndex)
+		return mt.pushBatchLeaf(newLeaf, bn, lvl, path, pathOldLeaf)
+	case NodeTypeMiddle:
+		if bn.childL == nil {
+			// First modification of a stored middle node
+			bn = &batchNode{childL: newBatchNodeKey(bn.node.ChildL),
+				childR: newBatchNodeKey(bn.node.ChildR)}
+		}
+		var err error
+		if path[lvl] {
+			bn.childR, err = mt.addBatchLeaf(bn.childR, newLeaf, lvl+1, path) // go right
+		} else {
+			bn.childL, err = mt.addBatchLeaf(bn.childL, newLeaf, lvl+1, path) // go left
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bn, nil
+	default:
+		return nil, ErrInvalidNodeFound
+	}
+}
+
+// storeBatchNode computes the keys of the modified nodes of the in-memory tree
+// bn, adding them to the storage, and returns the key of bn.
+func (mt *MerkleTree) storeBatchNode(tx db.Tx, bn *batchNode) (*Hash, error) {
+	switch {
+	case bn.key != nil:
+		return bn.key, nil
+	case bn.entry != nil:
+		return mt.addNode(tx, newNodeLeafHasher(mt.hasher, bn.entry))
+	default:
+		keyL, err := mt.storeBatchNode(tx, bn.childL)
+		if err != nil {
+			return nil, err
+		}
+		keyR, err := mt.storeBatchNode(tx, bn.childR)
+		if err != nil {
+			return nil, err
+		}
+		return mt.addNode(tx, newNodeMiddleHasher(mt.hasher, keyL, keyR))
+	}
+}
+
+// addBatch adds all the entries to the tree with the current root in the tx,
+// returning the new root key.
+func (mt *MerkleTree) addBatch(tx db.Tx, entries []*Entry) (*Hash, error) {
+	var err error
+	root := newBatchNodeKey(mt.rootKey)
+	for _, e := range entries {
+		path := getPath(mt.maxLevels, e.HIndexHasher(mt.hasher))
+		root, err = mt.addBatchLeaf(root, &batchNode{entry: e}, 0, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mt.storeBatchNode(tx, root)
+}
+
+// entriesHIndexes returns the hIndexes of the entries.
+func entriesHIndexes(hasher Hasher, entries []*Entry) []*Hash {
+	hIndexes := make([]*Hash, len(entries))
+	for i, e := range entries {
+		hIndexes[i] = e.HIndexHasher(hasher)
+	}
+	return hIndexes
+}
+
+// AddBatch adds all the entries to the MerkleTree in a single transaction.
+// The keys of the middle nodes are only computed once after all the entries
+// have been inserted.  If any entry can't be added, none of them are added.
+// An empty batch doesn't modify the MerkleTree nor log its root.
+func (mt *MerkleTree) AddBatch(entries []*Entry) error {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, e := range entries {
+		if err := checkEntryInField(e); err != nil {
+			return err
+		}
+	}
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	newRootKey, err := mt.addBatch(tx, entries)
+	if err != nil {
+		return err
+	}
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, entriesHIndexes(mt.hasher, entries)); err != nil {
+		return err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return err
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return nil
+}
@@ -0,0 +1,119 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddBatch(t *testing.T) {
+	mt1 := newTestingMerkle(t, 140)
+	defer mt1.Storage().Close()
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt1.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	var entries []*Entry
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		entries = append(entries, &e)
+	}
+	assert.Nil(t, mt2.AddBatch(entries))
+	assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+
+	for _, e := range entries {
+		proof, err := mt2.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.True(t, proof.Existence)
+		assert.True(t, VerifyProof(mt2.RootKey(), proof, e.HIndex(), e.HValue()))
+	}
+}
+
+func TestAddBatchNonEmptyTree(t *testing.T) {
+	mt1 := newTestingMerkle(t, 140)
+	defer mt1.Storage().Close()
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt1.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	var entries []*Entry
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if i%2 == 0 {
+			if err := mt2.Add(&e); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			entries = append(entries, &e)
+		}
+	}
+	assert.Nil(t, mt2.AddBatch(entries))
+	assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+
+	// An empty batch doesn't modify the tree nor log its root
+	logLen, err := mt2.RootLogLen()
+	assert.Nil(t, err)
+	assert.Nil(t, mt2.AddBatch(nil))
+	assert.Nil(t, mt2.AddBatch([]*Entry{}))
+	assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+	logLen2, err := mt2.RootLogLen()
+	assert.Nil(t, err)
+	assert.Equal(t, logLen, logLen2)
+}
+
+func TestAddBatchAllOrNothing(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+	e0 := NewEntryFromInts(0, 0, 0, 0)
+	if err := mt.Add(&e0); err != nil {
+		t.Fatal(err)
+	}
+	root := mt.RootKey()
+
+	e1 := NewEntryFromInts(0, 0, 0, 1)
+	e2 := NewEntryFromInts(0, 0, 0, 2)
+	e1Repeated := NewEntryFromInts(0, 9, 0, 1)
+	err = mt.AddBatch([]*Entry{&e1, &e2, &e1Repeated})
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+	_, err = mt.GetDataByIndex(e1.HIndex())
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+
+	e0Repeated := NewEntryFromInts(0, 9, 0, 0)
+	err = mt.AddBatch([]*Entry{&e1, &e0Repeated})
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+
+	// The stored root is not modified
+	mtReopened, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, root, mtReopened.RootKey())
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	mt := newTestingMerkle(b, 140)
+	defer mt.Storage().Close()
+
+	entries := make([]*Entry, b.N)
+	for i := 0; i < b.N; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		entries[i] = &e
+	}
+	b.ResetTimer()
+	if err := mt.AddBatch(entries); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+package merkletree
+
+import (
+	"runtime"
+	"sync"
+)
+
+// bulkMinParallelEntries is the minimum number of entries of a subtree for
+// AddBulk to build its two halves concurrently.
+const bulkMinParallelEntries = 64
+
+// bulkEntry is an entry to be inserted by AddBulk, or an existing leaf that
+// has to be pushed down.
+type bulkEntry struct {
+	entry  *Entry
+	hIndex *Hash
+	hValue *Hash
+	path   []bool
+	// leaf is the existing leaf of the entry, if any.
+	leaf *Node
+}
+
+// bulkBuilder holds the state of an AddBulk.
+type bulkBuilder struct {
+	mt *MerkleTree
+	// parallelLvls is the number of levels from the root where the
+	// subtrees are built concurrently.
+	parallelLvls int
+}
+
+// splitBulkEntries splits the entries by their path at level lvl.
+func splitBulkEntries(entries []*bulkEntry, lvl int) ([]*bulkEntry, []*bulkEntry) {
+	var entriesL, entriesR []*bulkEntry
+	for _, be := range entries {
+		if be.path[lvl] {
+			entriesR = append(entriesR, be)
+		} else {
+			entriesL = append(entriesL, be)
+		}
+	}
+	return entriesL, entriesR
+}
+
+// buildChildren builds the left and right subtrees at level lvl+1, each one
+// from its entries and existing key, and returns the key of the middle node
+// that joins them.  The new nodes are appended to nodes.
+func (b *bulkBuilder) buildChildren(entriesL, entriesR []*bulkEntry, keyL, keyR *Hash,
+	lvl int, nodes *[]*Node) (*Hash, error) {
+	var newKeyL, newKeyR *Hash
+	var errL, errR error
+	if lvl < b.parallelLvls && len(entriesL) > 0 && len(entriesR) > 0 &&
+		len(entriesL)+len(entriesR) >= bulkMinParallelEntries {
+		var nodesL []*Node
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			newKeyL, errL = b.build(entriesL, keyL, lvl+1, &nodesL)
+		}()
+		newKeyR, errR = b.build(entriesR, keyR, lvl+1, nodes)
+		wg.Wait()
+		*nodes = append(*nodes, nodesL...)
+	} else {
+		newKeyL, errL = b.build(entriesL, keyL, lvl+1, nodes)
+		if errL == nil {
+			newKeyR, errR = b.build(entriesR, keyR, lvl+1, nodes)
+		}
+	}
+	if errL != nil {
+		return nil, errL
+	} else if errR != nil {
+		return nil, errR
+	}
+	n := newNodeMiddleHasher(b.mt.hasher, newKeyL, newKeyR)
+	*nodes = append(*nodes, n)
+	return n.Key(), nil
+}
+
+// build recursively builds the subtree at level lvl with the entries merged
+// into the existing subtree with key, returning its key.  The new nodes are
+// appended to nodes.  The resulting subtree is the same one obtained by
+// adding the entries one by one.
+func (b *bulkBuilder) build(entries []*bulkEntry, key *Hash, lvl int, nodes *[]*Node) (*Hash, error) {
+	if len(entries) == 0 {
+		return key, nil
+	}
+	n, err := b.mt.GetNode(key)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Type {
+	case NodeTypeMiddle:
+		entriesL, entriesR := splitBulkEntries(entries, lvl)
+		return b.buildChildren(entriesL, entriesR, n.ChildL, n.ChildR, lvl, nodes)
+	case NodeTypeLeaf:
+		// The existing leaf is pushed down together with the entries
+		hIndex := n.Entry.HIndexHasher(b.mt.hasher)
+		leaf := &bulkEntry{hIndex: hIndex, path: getPath(b.mt.maxLevels, hIndex), leaf: n}
+		entries = append(append([]*bulkEntry{}, entries...), leaf)
+	case NodeTypeEmpty:
+	default:
+		return nil, ErrInvalidNodeFound
+	}
+
+	if len(entries) == 1 {
+		be := entries[0]
+		if be.leaf != nil {
+			return be.leaf.Key(), nil
+		}
+		leaf := newNodeLeafHasher(b.mt.hasher, be.entry)
+		leaf.key = leafKeyHasher(b.mt.hasher, be.hIndex, be.hValue)
+		*nodes = append(*nodes, leaf)
+		return leaf.Key(), nil
+	}
+	if lvl > b.mt.maxLevels-2 {
+		hIndexes := make(map[Hash]struct{})
+		for _, be := range entries {
+			if _, ok := hIndexes[*be.hIndex]; ok {
+				return nil, ErrEntryIndexAlreadyExists
+			}
+			hIndexes[*be.hIndex] = struct{}{}
+		}
+		return nil, ErrReachedMaxLevel
+	}
+	entriesL, entriesR := splitBulkEntries(entries, lvl)
+	return b.buildChildren(entriesL, entriesR, &HashZero, &HashZero, lvl, nodes)
+}
+
+// newBulkEntries calculates the hIndex, hValue and path of the entries using
+// the given number of goroutines.  The hashes are not cached in the entries,
+// which belong to the caller and may be repeated, so that the goroutines
+// don't write to them.
+func (mt *MerkleTree) newBulkEntries(entries []*Entry, workers int) []*bulkEntry {
+	bulkEntries := make([]*bulkEntry, len(entries))
+	var wg sync.WaitGroup
+	chunk := (len(entries) + workers - 1) / workers
+	for start := 0; start < len(entries); start += chunk {
+		end := start + chunk
+		if end > len(entries) {
+			end = len(entries)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				hIndex := mt.hasher.HashElems(entries[i].Data[2:]...)
+				hValue := mt.hasher.HashElems(entries[i].Data[:2]...)
+				bulkEntries[i] = &bulkEntry{entry: entries[i], hIndex: hIndex,
+					hValue: hValue, path: getPath(mt.maxLevels, hIndex)}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return bulkEntries
+}
+
+// AddBulk adds all the entries to the MerkleTree in a single transaction,
+// like AddBatch, building the subtrees of different path prefixes
+// concurrently with up to the given number of goroutines (or the number of
+// CPUs if workers is 0).  The resulting root is the same as adding the
+// entries one by one.  If any entry can't be added, none of them are added.
+func (mt *MerkleTree) AddBulk(entries []*Entry, workers int) error {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	for _, e := range entries {
+		if err := checkEntryInField(e); err != nil {
+			return err
+		}
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	b := bulkBuilder{mt: mt}
+	for 1<<uint(b.parallelLvls) < workers {
+		b.parallelLvls++
+	}
+	bulkEntries := mt.newBulkEntries(entries, workers)
+	var nodes []*Node
+	newRootKey, err := b.build(bulkEntries, mt.rootKey, 0, &nodes)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if _, err = mt.addNode(tx, n); err != nil {
+			return err
+		}
+	}
+	hIndexes := make([]*Hash, len(bulkEntries))
+	for i, be := range bulkEntries {
+		hIndexes[i] = be.hIndex
+	}
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, hIndexes); err != nil {
+		return err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return err
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return nil
+}
@@ -0,0 +1,145 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddBulk(t *testing.T) {
+	mt1 := newTestingMerkle(t, 140)
+	defer mt1.Storage().Close()
+	var entries []*Entry
+	for i := 0; i < 512; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt1.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		e2 := NewEntryFromInts(0, int64(i), 0, int64(i))
+		entries = append(entries, &e2)
+	}
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		mt2 := newTestingMerkle(t, 140)
+		assert.Nil(t, mt2.AddBulk(entries, workers))
+		assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+
+		stats, err := mt2.Stats()
+		assert.Nil(t, err)
+		assert.Equal(t, walkedStats(t, mt2, mt2.RootKey()), stats)
+		mt2.Storage().Close()
+	}
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	assert.Nil(t, mt2.AddBulk(entries, 0))
+	for _, e := range entries[:32] {
+		proof, err := mt2.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.True(t, proof.Existence)
+		assert.True(t, VerifyProof(mt2.RootKey(), proof, e.HIndex(), e.HValue()))
+	}
+}
+
+func TestAddBulkNonEmptyTree(t *testing.T) {
+	mt1 := newTestingMerkle(t, 140)
+	defer mt1.Storage().Close()
+	for i := 0; i < 256; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt1.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	var entries []*Entry
+	for i := 0; i < 256; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if i%3 == 0 {
+			if err := mt2.Add(&e); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			entries = append(entries, &e)
+		}
+	}
+	assert.Nil(t, mt2.AddBulk(entries, 4))
+	assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+	stats, err := mt2.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, walkedStats(t, mt2, mt2.RootKey()), stats)
+
+	// An empty bulk doesn't modify the tree
+	assert.Nil(t, mt2.AddBulk(nil, 4))
+	assert.Equal(t, mt1.RootKey().Hex(), mt2.RootKey().Hex())
+}
+
+func TestAddBulkAllOrNothing(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+	e0 := NewEntryFromInts(0, 0, 0, 0)
+	if err := mt.Add(&e0); err != nil {
+		t.Fatal(err)
+	}
+	root := mt.RootKey()
+
+	e1 := NewEntryFromInts(0, 0, 0, 1)
+	e2 := NewEntryFromInts(0, 0, 0, 2)
+	e1Repeated := NewEntryFromInts(0, 9, 0, 1)
+	err = mt.AddBulk([]*Entry{&e1, &e2, &e1Repeated}, 2)
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+	_, err = mt.GetDataByIndex(e1.HIndex())
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+
+	// The same entry twice, hashed by several goroutines
+	entries := []*Entry{&e1}
+	for i := 0; i < 2*bulkMinParallelEntries; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i+3))
+		entries = append(entries, &e, &e)
+	}
+	err = mt.AddBulk(entries, 4)
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+
+	e0Repeated := NewEntryFromInts(0, 9, 0, 0)
+	err = mt.AddBulk([]*Entry{&e1, &e0Repeated}, 2)
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+
+	// The stored root is not modified
+	mtReopened, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, root, mtReopened.RootKey())
+}
+
+func TestAddBulkMaxLevels(t *testing.T) {
+	mt := newTestingMerkle(t, 4)
+	defer mt.Storage().Close()
+	var entries []*Entry
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		entries = append(entries, &e)
+	}
+	assert.Equal(t, ErrReachedMaxLevel, mt.AddBulk(entries, 0))
+	assert.Equal(t, &HashZero, mt.RootKey())
+}
+
+func BenchmarkAddBulk(b *testing.B) {
+	mt := newTestingMerkle(b, 140)
+	defer mt.Storage().Close()
+
+	entries := make([]*Entry, b.N)
+	for i := 0; i < b.N; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		entries[i] = &e
+	}
+	b.ResetTimer()
+	if err := mt.AddBulk(entries, 0); err != nil {
+		b.Fatal(err)
+	}
+}
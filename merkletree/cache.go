@@ -0,0 +1,129 @@
+package merkletree
+
+import (
+	"container/list"
+	"sync"
+)
+
+// NodeCacheStats are the statistics of the node cache of a MT.
+type NodeCacheStats struct {
+	// Size is the maximum number of nodes in the cache.
+	Size int
+	// Len is the number of nodes in the cache.
+	Len int
+	// Hits is the number of nodes found in the cache.
+	Hits uint64
+	// Misses is the number of nodes not found in the cache, that have been
+	// read from the storage.
+	Misses uint64
+}
+
+// nodeCacheItem is a node stored in the nodeCache.
+type nodeCacheItem struct {
+	key  Hash
+	node *Node
+}
+
+// nodeCache is a LRU cache of decoded nodes.  As the key of a node is the hash
+// of its content, a cached node never becomes stale; it only needs to be
+// removed when the node is deleted from the storage.
+type nodeCache struct {
+	sync.Mutex
+	size   int
+	ll     *list.List
+	items  map[Hash]*list.Element
+	hits   uint64
+	misses uint64
+}
+
+// newNodeCache creates a nodeCache that holds up to size nodes.
+func newNodeCache(size int) *nodeCache {
+	return &nodeCache{size: size, ll: list.New(), items: make(map[Hash]*list.Element)}
+}
+
+// cloneNode returns a copy of the node n, so that the nodes in the cache can't
+// be modified by the callers of GetNode.
+func cloneNode(n *Node) *Node {
+	c := *n
+	if n.Entry != nil {
+		e := *n.Entry
+		c.Entry = &e
+	}
+	return &c
+}
+
+// get returns a copy of the node with key, if it's in the cache.
+func (c *nodeCache) get(key *Hash) (*Node, bool) {
+	c.Lock()
+	defer c.Unlock()
+	elem, ok := c.items[*key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.ll.MoveToFront(elem)
+	return cloneNode(elem.Value.(*nodeCacheItem).node), true
+}
+
+// add adds the node n with key to the cache, evicting the least recently used
+// node if the cache is full.  The hashes of the node are calculated before
+// adding it, so that they are shared by all the copies returned by get.
+func (c *nodeCache) add(key *Hash, n *Node) {
+	n.key = &Hash{}
+	copy(n.key[:], key[:])
+	if n.Type == NodeTypeLeaf {
+		n.Entry.HIndexHasher(n.hashFn())
+		n.Entry.HValueHasher(n.hashFn())
+	}
+	c.Lock()
+	defer c.Unlock()
+	if elem, ok := c.items[*key]; ok {
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[*key] = c.ll.PushFront(&nodeCacheItem{key: *key, node: n})
+	if c.ll.Len() > c.size {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.items, last.Value.(*nodeCacheItem).key)
+	}
+}
+
+// remove removes the node with key from the cache.
+func (c *nodeCache) remove(key *Hash) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, ok := c.items[*key]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, *key)
+	}
+}
+
+// stats returns the statistics of the cache.
+func (c *nodeCache) stats() NodeCacheStats {
+	c.Lock()
+	defer c.Unlock()
+	return NodeCacheStats{Size: c.size, Len: c.ll.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// SetNodeCache enables a LRU cache of up to size decoded nodes in front of the
+// storage of the MT, or disables it if size is 0.  The cache is shared with
+// the snapshots of the MT created afterwards.  It must be set before the MT
+// is used concurrently.
+func (mt *MerkleTree) SetNodeCache(size int) {
+	if size <= 0 {
+		mt.cache = nil
+		return
+	}
+	mt.cache = newNodeCache(size)
+}
+
+// NodeCacheStats returns the statistics of the node cache of the MT.  If the
+// cache is not enabled, all the statistics are 0.
+func (mt *MerkleTree) NodeCacheStats() NodeCacheStats {
+	if mt.cache == nil {
+		return NodeCacheStats{}
+	}
+	return mt.cache.stats()
+}
@@ -0,0 +1,100 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeCache(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	mt.SetNodeCache(1024)
+
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := NewEntryFromInts(0, 7, 0, 7)
+	proof1, err := mt.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	stats1 := mt.NodeCacheStats()
+	assert.Equal(t, 1024, stats1.Size)
+
+	// The second time all the nodes are found in the cache
+	proof2, err := mt.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, proof1, proof2)
+	assert.True(t, VerifyProof(mt.RootKey(), proof2, e.HIndex(), e.HValue()))
+	stats2 := mt.NodeCacheStats()
+	assert.Equal(t, stats1.Misses, stats2.Misses)
+	assert.Equal(t, stats1.Hits+uint64(proof2.depth+1), stats2.Hits)
+
+	// The snapshots share the cache
+	snapshot, err := mt.Snapshot(mt.RootKey())
+	assert.Nil(t, err)
+	_, err = snapshot.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, stats2.Misses, mt.NodeCacheStats().Misses)
+
+	// Modifying the returned nodes doesn't modify the cached ones
+	n, err := mt.GetNode(mt.RootKey())
+	assert.Nil(t, err)
+	n.ChildL = &HashZero
+	n, err = mt.GetNode(mt.RootKey())
+	assert.Nil(t, err)
+	assert.Equal(t, mt.RootKey(), n.Key())
+}
+
+func TestNodeCacheEviction(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	mt.SetNodeCache(8)
+
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		data, err := mt.GetDataByIndex(e.HIndex())
+		assert.Nil(t, err)
+		assert.Equal(t, e.Data, *data)
+	}
+	stats := mt.NodeCacheStats()
+	assert.Equal(t, 8, stats.Len)
+	assert.True(t, stats.Hits > 0)
+
+	// Disabling the cache
+	mt.SetNodeCache(0)
+	assert.Equal(t, NodeCacheStats{}, mt.NodeCacheStats())
+}
+
+func TestNodeCachePrune(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	mt.SetNodeCache(1024)
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRoot := mt.RootKey()
+	_, err := mt.GetNode(oldRoot)
+	assert.Nil(t, err)
+	e := NewEntryFromInts(0, 16, 0, 16)
+	assert.Nil(t, mt.Add(&e))
+
+	// The pruned nodes are removed from the cache
+	_, err = mt.Prune(nil)
+	assert.Nil(t, err)
+	_, err = mt.GetNode(oldRoot)
+	assert.NotNil(t, err)
+}
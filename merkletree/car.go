@@ -0,0 +1,163 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+var (
+	// ErrCARLinkMismatch is used when the links of a block of a CAR archive
+	// don't match the children of its node.
+	ErrCARLinkMismatch = errors.New("the links of the CAR block don't match its node")
+	// ErrCARRootMismatch is used when the root key recorded in a CAR
+	// archive doesn't match the key of its root node.
+	ErrCARRootMismatch = errors.New("the root of the CAR archive doesn't match its root node")
+)
+
+// carRootMagic is the beginning of the value of the root block of the CAR
+// archives written by ExportCAR, which is followed by the kind of hash
+// function and the key of the root node of the tree.  It's also the key of
+// the root block in the export, as it can't be the key of a node.
+var carRootMagic = []byte("iden3merkletree")
+
+// carRootValue returns the value of the root block of a CAR archive of the
+// tree with rootKey that uses the hash function of hashKind.
+func carRootValue(hashKind HashKind, rootKey *Hash) []byte {
+	return append(append(append([]byte{}, carRootMagic...), byte(hashKind)), rootKey[:]...)
+}
+
+// nodeLinks returns the keys of the children of the node that are not empty.
+func nodeLinks(n *Node) [][]byte {
+	var links [][]byte
+	if n.Type == NodeTypeMiddle {
+		for _, child := range []*Hash{n.ChildL, n.ChildR} {
+			if !bytes.Equal(child[:], HashZero[:]) {
+				links = append(links, child[:])
+			}
+		}
+	}
+	return links
+}
+
+// ExportCAR writes to w a CAR archive with all the nodes of the tree with the
+// given rootKey (or the current root if rootKey is nil) as content-addressed
+// blocks, where each middle node links to its children (see db.IPFSexport).
+// The root of the archive is a block with the kind of hash function and the
+// rootKey of the tree that links to its root node.  The archive can be
+// imported into any storage with ImportCAR, or into IPFS.  All the blocks are
+// built in memory before writing them, so it's meant for trees that fit in
+// memory.
+func (mt *MerkleTree) ExportCAR(w io.Writer, rootKey *Hash) error {
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	return db.IPFSexport(w, carRootMagic, func(key []byte) ([]byte, [][]byte, error) {
+		if bytes.Equal(key, carRootMagic) {
+			return carRootValue(mt.HashKind(), rootKey), [][]byte{rootKey[:]}, nil
+		}
+		var k Hash
+		copy(k[:], key)
+		n, err := mt.GetNode(&k)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n.Type == NodeTypeEmpty {
+			// The value of an empty node is empty, but it's exported
+			// with its type so that it can be parsed.
+			return []byte{byte(NodeTypeEmpty)}, nil, nil
+		}
+		return n.Value(), nodeLinks(n), nil
+	})
+}
+
+// carBlock is a block read from a CAR archive, with the indexes of the blocks
+// it links to.
+type carBlock struct {
+	value []byte
+	links []int
+}
+
+// ImportCAR adds into the storage of the MT all the nodes of a CAR archive
+// written by ExportCAR, verifying the CID of every block and the key of every
+// node, and returns the key of the root of the archive.  If the archive was
+// written by a tree with another hash function, ErrHashKindMismatch is
+// returned, and if the key of its root node doesn't match the recorded root,
+// ErrCARRootMismatch.  All the nodes are added in a single transaction, and
+// the whole archive is kept in memory meanwhile.  Like Sync, the current root
+// of the MT is not modified; the imported tree can be used with
+// Snapshot(rootKey).
+func (mt *MerkleTree) ImportCAR(r io.Reader) (*Hash, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	// The blocks are read first, in the order in which they must be added
+	// (children before parents, and the root block last), so that the
+	// hash function is checked before hashing the nodes.
+	var blocks []carBlock
+	if _, err := db.IPFSimport(r, func(value []byte, links [][]byte) ([]byte, error) {
+		b := carBlock{value: value, links: make([]int, len(links))}
+		for i, link := range links {
+			b.links[i] = int(binary.BigEndian.Uint32(link))
+		}
+		// The key of a block is its index
+		var key [4]byte
+		binary.BigEndian.PutUint32(key[:], uint32(len(blocks)))
+		blocks = append(blocks, b)
+		return key[:], nil
+	}); err != nil {
+		return nil, err
+	}
+
+	root := blocks[len(blocks)-1]
+	if len(root.value) != len(carRootMagic)+1+ElemBytesLen ||
+		!bytes.HasPrefix(root.value, carRootMagic) || len(root.links) != 1 {
+		return nil, db.ErrInvalidCAR
+	}
+	if HashKind(root.value[len(carRootMagic)]) != mt.HashKind() {
+		return nil, ErrHashKindMismatch
+	}
+	rootKey := &Hash{}
+	copy(rootKey[:], root.value[len(carRootMagic)+1:])
+
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Hash, len(blocks)-1)
+	for i, b := range blocks[:len(blocks)-1] {
+		n, err := NewNodeFromBytes(b.value)
+		if err != nil {
+			tx.Close()
+			return nil, err
+		}
+		n.hasher = mt.hasher
+		nLinks := nodeLinks(n)
+		if len(nLinks) != len(b.links) {
+			tx.Close()
+			return nil, ErrCARLinkMismatch
+		}
+		for j, link := range b.links {
+			if !bytes.Equal(nLinks[j], keys[link][:]) {
+				tx.Close()
+				return nil, ErrCARLinkMismatch
+			}
+		}
+		if keys[i], err = mt.addNode(tx, n); err != nil {
+			tx.Close()
+			return nil, err
+		}
+	}
+	if !bytes.Equal(keys[root.links[0]][:], rootKey[:]) {
+		tx.Close()
+		return nil, ErrCARRootMismatch
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rootKey, nil
+}
@@ -0,0 +1,142 @@
+package merkletree
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportCAR(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := mt.RootKey()
+	e := NewEntryFromInts(0, 100, 0, 100)
+	assert.Nil(t, mt.Add(&e))
+
+	var car bytes.Buffer
+	assert.Nil(t, mt.ExportCAR(&car, root))
+	var car2 bytes.Buffer
+	assert.Nil(t, mt.ExportCAR(&car2, root))
+	assert.Equal(t, car.Bytes(), car2.Bytes())
+
+	sto := db.NewMemoryStorage()
+	mt2, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	defer mt2.Storage().Close()
+	rootKey, err := mt2.ImportCAR(bytes.NewReader(car.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, root, rootKey)
+	// The current root is not modified
+	assert.Equal(t, &HashZero, mt2.RootKey())
+
+	snapshot, err := mt2.Snapshot(rootKey)
+	assert.Nil(t, err)
+	entries, _ := iterateLeafs(t, mt.LeafIterator(root), 0)
+	imported, _ := iterateLeafs(t, snapshot.LeafIterator(nil), 0)
+	assert.Equal(t, entriesBytes(entries), entriesBytes(imported))
+	report, err := Check(sto, rootKey)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+
+	// An empty tree
+	car.Reset()
+	assert.Nil(t, mt2.ExportCAR(&car, nil))
+	rootKey, err = mt.ImportCAR(&car)
+	assert.Nil(t, err)
+	assert.Equal(t, &HashZero, rootKey)
+}
+
+func TestImportCARInvalid(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var car bytes.Buffer
+	assert.Nil(t, mt.ExportCAR(&car, nil))
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	_, err := mt2.ImportCAR(bytes.NewReader(nil))
+	assert.Equal(t, db.ErrInvalidCAR, err)
+	_, err = mt2.ImportCAR(bytes.NewReader(car.Bytes()[:car.Len()-1]))
+	assert.Equal(t, db.ErrInvalidCAR, err)
+
+	// A modified block
+	tampered := append([]byte{}, car.Bytes()...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = mt2.ImportCAR(bytes.NewReader(tampered))
+	assert.Equal(t, db.ErrCARBlockMismatch, err)
+
+	// A block whose links are not the children of its node
+	var swapped bytes.Buffer
+	assert.Nil(t, db.IPFSexport(&swapped, carRootMagic, func(key []byte) ([]byte, [][]byte, error) {
+		if bytes.Equal(key, carRootMagic) {
+			return carRootValue(mt.HashKind(), mt.RootKey()), [][]byte{mt.RootKey()[:]}, nil
+		}
+		var k Hash
+		copy(k[:], key)
+		n, err := mt.GetNode(&k)
+		if err != nil {
+			return nil, nil, err
+		}
+		links := nodeLinks(n)
+		if len(links) == 2 {
+			links[0], links[1] = links[1], links[0]
+		}
+		return n.Value(), links, nil
+	}))
+	_, err = mt2.ImportCAR(&swapped)
+	assert.Equal(t, ErrCARLinkMismatch, err)
+
+	// A root block with another root key, or without a root block
+	exportCAR := func(w io.Writer, rootBlock bool, rootKey *Hash) error {
+		archiveRoot := carRootMagic
+		if !rootBlock {
+			archiveRoot = mt.RootKey()[:]
+		}
+		return db.IPFSexport(w, archiveRoot, func(key []byte) ([]byte, [][]byte, error) {
+			if bytes.Equal(key, carRootMagic) {
+				return carRootValue(mt.HashKind(), rootKey), [][]byte{mt.RootKey()[:]}, nil
+			}
+			var k Hash
+			copy(k[:], key)
+			n, err := mt.GetNode(&k)
+			if err != nil {
+				return nil, nil, err
+			}
+			return n.Value(), nodeLinks(n), nil
+		})
+	}
+	var wrongRoot bytes.Buffer
+	assert.Nil(t, exportCAR(&wrongRoot, true, &HashZero))
+	_, err = mt2.ImportCAR(&wrongRoot)
+	assert.Equal(t, ErrCARRootMismatch, err)
+	var noRoot bytes.Buffer
+	assert.Nil(t, exportCAR(&noRoot, false, mt.RootKey()))
+	_, err = mt2.ImportCAR(&noRoot)
+	assert.Equal(t, db.ErrInvalidCAR, err)
+
+	// An archive of a tree with another hash function
+	mtMimc7, err := NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	defer mtMimc7.Storage().Close()
+	_, err = mtMimc7.ImportCAR(bytes.NewReader(car.Bytes()))
+	assert.Equal(t, ErrHashKindMismatch, err)
+
+	// Nothing has been added
+	_, err = mt2.GetNode(mt.RootKey())
+	assert.Equal(t, db.ErrNotFound, err)
+}
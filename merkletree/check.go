@@ -0,0 +1,181 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// checkMaxLevels is the maximum depth of a MT that Check allows, which is the
+// number of bits of a hIndex.
+const checkMaxLevels = ElemBytesLen * 8
+
+var (
+	// ErrNodeNotFound is used when a node referenced by its parent is not
+	// in the storage.
+	ErrNodeNotFound = errors.New("node not found in the DB")
+	// ErrNodeKeyMismatch is used when the key of a node is not the hash of
+	// its value.
+	ErrNodeKeyMismatch = errors.New("the node key doesn't match its value")
+	// ErrLeafWrongPath is used when a leaf is found in a position that
+	// doesn't match the path of its hIndex.
+	ErrLeafWrongPath = errors.New("the leaf is not in the path of its hIndex")
+	// ErrNodeNotCompact is used when a middle node has no leafs below it,
+	// or only one, which should have been placed in its position instead.
+	ErrNodeNotCompact = errors.New("the middle node has less than two leafs below")
+)
+
+// CheckError is a problem found by Check in a node of a MT.
+type CheckError struct {
+	// Key is the key of the node.
+	Key *Hash
+	// Path is the path from the root to the node, where true means right.
+	Path []bool
+	// Err is the problem found in the node.
+	Err error
+}
+
+// pathString returns the path as a string of 0 (left) and 1 (right).
+func pathString(path []bool) string {
+	var buf bytes.Buffer
+	for _, right := range path {
+		if right {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	}
+	return buf.String()
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("node %v at level %v (path %q): %v", e.Key.Hex(), len(e.Path),
+		pathString(e.Path), e.Err)
+}
+
+// CheckReport is the result of a Check of a MT.
+type CheckReport struct {
+	// Root is the key of the root node of the checked tree.
+	Root *Hash
+	// HashKind is the kind of hash function of the MT.
+	HashKind HashKind
+	// Nodes is the number of nodes checked, excluding the empty ones.
+	Nodes int
+	// Leafs is the number of leafs found.
+	Leafs int
+	// Errors are the problems found.
+	Errors []*CheckError
+}
+
+// Ok returns true if no problems have been found.
+func (r *CheckReport) Ok() bool {
+	return len(r.Errors) == 0
+}
+
+// checker holds the state of a Check.
+type checker struct {
+	storage db.Storage
+	hasher  Hasher
+	report  *CheckReport
+}
+
+func (c *checker) addError(key *Hash, path []bool, err error) {
+	c.report.Errors = append(c.report.Errors,
+		&CheckError{Key: key, Path: append([]bool{}, path...), Err: err})
+}
+
+// checkNode recursively checks the node with key found at path, and returns
+// the number of leafs below it.
+func (c *checker) checkNode(key *Hash, path []bool) (int, error) {
+	if bytes.Equal(key[:], HashZero[:]) {
+		return 0, nil
+	}
+	if len(path) >= checkMaxLevels {
+		c.addError(key, path, ErrReachedMaxLevel)
+		return 0, nil
+	}
+	v, err := c.storage.Get(key[:])
+	if err == db.ErrNotFound {
+		c.addError(key, path, ErrNodeNotFound)
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	n, err := NewNodeFromBytes(v)
+	if err != nil {
+		c.addError(key, path, err)
+		return 0, nil
+	}
+	c.report.Nodes++
+	n.hasher = c.hasher
+	if n.Type == NodeTypeEmpty {
+		c.addError(key, path, ErrInvalidNodeFound)
+		return 0, nil
+	}
+	if !bytes.Equal(n.Key()[:], key[:]) {
+		c.addError(key, path, ErrNodeKeyMismatch)
+	}
+	switch n.Type {
+	case NodeTypeLeaf:
+		c.report.Leafs++
+		hIndex := n.Entry.HIndexHasher(c.hasher)
+		for lvl, right := range path {
+			if testBitBigEndian(hIndex[:], uint(lvl)) != right {
+				c.addError(key, path, ErrLeafWrongPath)
+				break
+			}
+		}
+		return 1, nil
+	default: // NodeTypeMiddle
+		leafsL, err := c.checkNode(n.ChildL, append(path, false))
+		if err != nil {
+			return 0, err
+		}
+		leafsR, err := c.checkNode(n.ChildR, append(path, true))
+		if err != nil {
+			return 0, err
+		}
+		if leafsL+leafsR < 2 {
+			c.addError(key, path, ErrNodeNotCompact)
+		}
+		return leafsL + leafsR, nil
+	}
+}
+
+// Check verifies the consistency of the tree with the given rootKey of the MT
+// stored in storage (the same storage passed to NewMerkleTree).  If rootKey is
+// nil, the current root of the MT is checked.  Every node is checked to be in
+// the storage, to have a key that matches its value, and, for the leafs, to
+// be placed in the path of its hIndex.  The problems found are returned in the
+// CheckReport; an error is only returned if the storage can't be read.
+func Check(storage db.Storage, rootKey *Hash) (*CheckReport, error) {
+	mt := MerkleTree{storage: storage.WithPrefix(PREFIX_MERKLETREE)}
+	kind, err := mt.dbGetHashKind()
+	if err != nil {
+		return nil, err
+	}
+	hasher, _ := kind.Hasher()
+	if rootKey == nil {
+		t, rootBytes, err := mt.dbGet(rootNodeValue)
+		if err != nil {
+			return nil, err
+		}
+		if t != DBEntryTypeRoot || len(rootBytes) != ElemBytesLen {
+			return nil, ErrInvalidDBValue
+		}
+		rootKey = &Hash{}
+		copy(rootKey[:], rootBytes)
+	}
+
+	c := checker{
+		storage: mt.storage,
+		hasher:  hasher,
+		report:  &CheckReport{Root: rootKey, HashKind: kind},
+	}
+	if _, err := c.checkNode(rootKey, []bool{}); err != nil {
+		return nil, err
+	}
+	return c.report, nil
+}
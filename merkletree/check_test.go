@@ -0,0 +1,160 @@
+package merkletree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestingCheckMerkle returns the storage and a MT of it with 16 entries.
+func newTestingCheckMerkle(t *testing.T) (db.Storage, *MerkleTree) {
+	storage := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(storage, 140)
+	assert.Nil(t, err)
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storage, mt
+}
+
+// putNodes stores the nodes in the storage of the MT under their keys.
+func putNodes(t *testing.T, mt *MerkleTree, nodes ...*Node) {
+	tx, err := mt.Storage().NewTx()
+	assert.Nil(t, err)
+	for _, n := range nodes {
+		tx.Put(n.Key()[:], n.Value())
+	}
+	assert.Nil(t, tx.Commit())
+}
+
+func TestCheck(t *testing.T) {
+	storage, mt := newTestingCheckMerkle(t)
+	defer storage.Close()
+	root16 := mt.RootKey()
+	for i := 16; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Check(storage, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+	assert.Equal(t, mt.RootKey(), report.Root)
+	assert.Equal(t, HashKindPoseidon, report.HashKind)
+	assert.Equal(t, 32, report.Leafs)
+	assert.Equal(t, countReachableNodes(t, mt, mt.RootKey()), report.Nodes)
+
+	report, err = Check(storage, root16)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+	assert.Equal(t, 16, report.Leafs)
+
+	// An empty tree
+	report, err = Check(storage, &HashZero)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+	assert.Equal(t, 0, report.Nodes)
+}
+
+func TestCheckMimc7(t *testing.T) {
+	storage := db.NewMemoryStorage()
+	defer storage.Close()
+	mt, err := NewMerkleTreeHash(storage, 140, HashKindMimc7)
+	assert.Nil(t, err)
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Check(storage, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+	assert.Equal(t, HashKindMimc7, report.HashKind)
+	assert.Equal(t, 8, report.Leafs)
+}
+
+func TestCheckNodeNotFound(t *testing.T) {
+	storage, mt := newTestingCheckMerkle(t)
+	defer storage.Close()
+	root, err := mt.GetNode(mt.RootKey())
+	assert.Nil(t, err)
+	childKey, path := root.ChildL, []bool{false}
+	if bytes.Equal(childKey[:], HashZero[:]) {
+		childKey, path = root.ChildR, []bool{true}
+	}
+
+	tx, err := mt.Storage().NewTx()
+	assert.Nil(t, err)
+	tx.Delete(childKey[:])
+	assert.Nil(t, tx.Commit())
+
+	report, err := Check(storage, nil)
+	assert.Nil(t, err)
+	assert.False(t, report.Ok())
+	assert.Equal(t, ErrNodeNotFound, report.Errors[0].Err)
+	assert.Equal(t, childKey, report.Errors[0].Key)
+	assert.Equal(t, path, report.Errors[0].Path)
+}
+
+func TestCheckNodeKeyMismatch(t *testing.T) {
+	storage, mt := newTestingCheckMerkle(t)
+	defer storage.Close()
+	e := NewEntryFromInts(0, 5, 0, 5)
+	proof, err := mt.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	assert.True(t, proof.Existence)
+
+	// Replace the value of the leaf by another one with the same hIndex
+	eBad := NewEntryFromInts(1, 5, 0, 5)
+	tx, err := mt.Storage().NewTx()
+	assert.Nil(t, err)
+	tx.Put(NewNodeLeaf(&e).Key()[:], NewNodeLeaf(&eBad).Value())
+	assert.Nil(t, tx.Commit())
+
+	report, err := Check(storage, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(report.Errors))
+	assert.Equal(t, ErrNodeKeyMismatch, report.Errors[0].Err)
+	assert.Equal(t, NewNodeLeaf(&e).Key(), report.Errors[0].Key)
+	assert.Equal(t, getPath(int(proof.depth), e.HIndex()), report.Errors[0].Path)
+}
+
+func TestCheckLeafWrongPath(t *testing.T) {
+	storage := db.NewMemoryStorage()
+	defer storage.Close()
+	mt, err := NewMerkleTree(storage, 140)
+	assert.Nil(t, err)
+
+	// A leaf whose path starts to the right placed alone to the left
+	var e Entry
+	for i := int64(0); ; i++ {
+		e = NewEntryFromInts(0, i, 0, i)
+		if testBitBigEndian(e.HIndex()[:], 0) {
+			break
+		}
+	}
+	leaf := NewNodeLeaf(&e)
+	root := NewNodeMiddle(leaf.Key(), &HashZero)
+	putNodes(t, mt, leaf, root)
+
+	report, err := Check(storage, root.Key())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Nodes)
+	assert.Equal(t, 1, report.Leafs)
+	assert.Equal(t, 2, len(report.Errors))
+	assert.Equal(t, ErrLeafWrongPath, report.Errors[0].Err)
+	assert.Equal(t, []bool{false}, report.Errors[0].Path)
+	assert.Equal(t, ErrNodeNotCompact, report.Errors[1].Err)
+	assert.Equal(t, []bool{}, report.Errors[1].Path)
+	assert.Equal(t, root.Key(), report.Errors[1].Key)
+	assert.Contains(t, report.Errors[0].Error(), `at level 1 (path "0")`)
+}
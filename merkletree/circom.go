@@ -0,0 +1,136 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// CircomVerifierProof contains the inputs of a circom circuit that verifies a
+// MT proof of existence or non-existence of an entry (with the same inputs as
+// the smtverifier circuit of circomlib).  The siblings are padded with zeros
+// to the number of levels of the circuit.
+type CircomVerifierProof struct {
+	// Root is the root of the MT.
+	Root *Hash
+	// Siblings are all the siblings of the path of the entry, including
+	// the empty ones, from the root to the leaf.
+	Siblings []*Hash
+	// OldKey and OldValue are the hIndex and hValue of the leaf found in
+	// the path of the entry in a proof of non-existence, if any.
+	OldKey   *Hash
+	OldValue *Hash
+	// IsOld0 indicates that the path of the entry ends in an empty node in
+	// a proof of non-existence.
+	IsOld0 bool
+	// Key and Value are the hIndex and hValue of the entry.
+	Key   *Hash
+	Value *Hash
+	// Fnc is 0 for a proof of existence, and 1 for a proof of
+	// non-existence.
+	Fnc int
+}
+
+// AllSiblings returns all the siblings of the proof, including the empty
+// ones, from the root to the leaf.
+func (p *Proof) AllSiblings() []*Hash {
+	siblings := make([]*Hash, p.depth)
+	sibIdx := 0
+	for i := uint(0); i < p.depth; i++ {
+		if testBitBigEndian(p.notempties[:], i) {
+			siblings[i] = p.Siblings[sibIdx]
+			sibIdx++
+		} else {
+			siblings[i] = &HashZero
+		}
+	}
+	return siblings
+}
+
+// NewCircomVerifierProof converts the proof of the entry with hIndex and
+// hValue in the MT with the given root into the inputs of a circuit of the
+// given number of levels.
+func NewCircomVerifierProof(proof *Proof, root, hIndex, hValue *Hash, levels int) (*CircomVerifierProof, error) {
+	if int(proof.depth) > levels {
+		return nil, ErrReachedMaxLevel
+	}
+	siblings := proof.AllSiblings()
+	for len(siblings) < levels {
+		siblings = append(siblings, &HashZero)
+	}
+	cp := &CircomVerifierProof{
+		Root:     root,
+		Siblings: siblings,
+		OldKey:   &HashZero,
+		OldValue: &HashZero,
+		Key:      hIndex,
+		Value:    hValue,
+	}
+	if !proof.Existence {
+		cp.Fnc = 1
+		if proof.nodeAux == nil {
+			cp.IsOld0 = true
+		} else {
+			cp.OldKey = proof.nodeAux.hIndex
+			cp.OldValue = proof.nodeAux.hValue
+		}
+	}
+	return cp, nil
+}
+
+// GenerateCircomVerifierProof generates the inputs of a circuit of maxLevels
+// levels that verifies the proof of existence (or non-existence) of the Entry
+// in the MT with the given root.
+// If the rootKey is nil, the current merkletree root is used
+func (mt *MerkleTree) GenerateCircomVerifierProof(e *Entry, rootKey *Hash) (*CircomVerifierProof, error) {
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	hIndex, hValue := e.HIndexHasher(mt.hasher), e.HValueHasher(mt.hasher)
+	proof, err := mt.GenerateProof(hIndex, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewCircomVerifierProof(proof, rootKey, hIndex, hValue, mt.maxLevels)
+}
+
+// circomVerifierProofJSON is the circom input JSON of a CircomVerifierProof,
+// where all the values are field elements in decimal.  Enabled is always 1, so
+// that the smtverifier circuit verifies the proof.
+type circomVerifierProofJSON struct {
+	Enabled  string   `json:"enabled"`
+	Root     string   `json:"root"`
+	Siblings []string `json:"siblings"`
+	OldKey   string   `json:"oldKey"`
+	OldValue string   `json:"oldValue"`
+	IsOld0   string   `json:"isOld0"`
+	Key      string   `json:"key"`
+	Value    string   `json:"value"`
+	Fnc      string   `json:"fnc"`
+}
+
+// boolToDecimal returns the field element of a boolean in decimal.
+func boolToDecimal(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// MarshalJSON encodes the CircomVerifierProof as a circom input JSON.
+func (cp *CircomVerifierProof) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(cp.Siblings))
+	for i, sib := range cp.Siblings {
+		siblings[i] = sib.BigInt().String()
+	}
+	return json.Marshal(circomVerifierProofJSON{
+		Enabled:  "1",
+		Root:     cp.Root.BigInt().String(),
+		Siblings: siblings,
+		OldKey:   cp.OldKey.BigInt().String(),
+		OldValue: cp.OldValue.BigInt().String(),
+		IsOld0:   boolToDecimal(cp.IsOld0),
+		Key:      cp.Key.BigInt().String(),
+		Value:    cp.Value.BigInt().String(),
+		Fnc:      strconv.Itoa(cp.Fnc),
+	})
+}
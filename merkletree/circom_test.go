@@ -0,0 +1,127 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// circomRoot calculates the root from the inputs of a CircomVerifierProof of
+// existence, ignoring the padding of empty siblings below the leaf.
+func circomRoot(cp *CircomVerifierProof) *Hash {
+	depth := len(cp.Siblings)
+	for depth > 0 && bytes.Equal(cp.Siblings[depth-1][:], HashZero[:]) {
+		depth--
+	}
+	midKey := LeafKey(cp.Key, cp.Value)
+	path := getPath(depth, cp.Key)
+	for lvl := depth - 1; lvl >= 0; lvl-- {
+		if path[lvl] {
+			midKey = NewNodeMiddle(cp.Siblings[lvl], midKey).Key()
+		} else {
+			midKey = NewNodeMiddle(midKey, cp.Siblings[lvl]).Key()
+		}
+	}
+	return midKey
+}
+
+func allZero(hs []*Hash) bool {
+	for _, h := range hs {
+		if !bytes.Equal(h[:], HashZero[:]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCircomVerifierProof(t *testing.T) {
+	mt := newTestingMerkle(t, 40)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Proof of existence
+	e := NewEntryFromInts(0, 3, 0, 3)
+	cp, err := mt.GenerateCircomVerifierProof(&e, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 40, len(cp.Siblings))
+	assert.Equal(t, 0, cp.Fnc)
+	assert.Equal(t, e.HIndex(), cp.Key)
+	assert.Equal(t, e.HValue(), cp.Value)
+	assert.Equal(t, mt.RootKey(), cp.Root)
+	assert.Equal(t, cp.Root, circomRoot(cp))
+
+	proof, err := mt.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	siblings := proof.AllSiblings()
+	assert.Equal(t, siblings, cp.Siblings[:len(siblings)])
+	assert.True(t, allZero(cp.Siblings[len(siblings):]))
+
+	// Proof of non-existence
+	for i := 16; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		cp, err := mt.GenerateCircomVerifierProof(&e, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, cp.Fnc)
+		proof, err := mt.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, proof.nodeAux == nil, cp.IsOld0)
+		if proof.nodeAux != nil {
+			assert.Equal(t, proof.nodeAux.hIndex, cp.OldKey)
+			assert.Equal(t, proof.nodeAux.hValue, cp.OldValue)
+		} else {
+			assert.Equal(t, &HashZero, cp.OldKey)
+		}
+	}
+
+	// The proof doesn't fit in a circuit with less levels
+	_, err = NewCircomVerifierProof(proof, mt.RootKey(), e.HIndex(), e.HValue(), int(proof.depth)-1)
+	assert.Equal(t, ErrReachedMaxLevel, err)
+}
+
+func TestCircomVerifierProofJSON(t *testing.T) {
+	mt := newTestingMerkle(t, 10)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 4; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEntryFromInts(0, 2, 0, 2)
+	cp, err := mt.GenerateCircomVerifierProof(&e, nil)
+	assert.Nil(t, err)
+
+	cpJSON, err := json.Marshal(cp)
+	assert.Nil(t, err)
+	var inputs map[string]interface{}
+	assert.Nil(t, json.Unmarshal(cpJSON, &inputs))
+	// All the inputs of the smtverifier circuit
+	var names []string
+	for name := range inputs {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{"enabled", "root", "siblings", "oldKey", "oldValue",
+		"isOld0", "key", "value", "fnc"}, names)
+	assert.Equal(t, "1", inputs["enabled"])
+	assert.Equal(t, mt.RootKey().BigInt().String(), inputs["root"])
+	assert.Equal(t, e.HIndex().BigInt().String(), inputs["key"])
+	assert.Equal(t, e.HValue().BigInt().String(), inputs["value"])
+	assert.Equal(t, "0", inputs["oldKey"])
+	assert.Equal(t, "0", inputs["oldValue"])
+	assert.Equal(t, "0", inputs["isOld0"])
+	assert.Equal(t, "0", inputs["fnc"])
+	siblings := inputs["siblings"].([]interface{})
+	assert.Equal(t, 10, len(siblings))
+	for i, sib := range siblings {
+		assert.Equal(t, cp.Siblings[i].BigInt().String(), sib)
+	}
+}
@@ -0,0 +1,386 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	common3 "github.com/iden3/go-iden3-core/common"
+)
+
+var (
+	// ErrNotConsistent is used when a ConsistencyProof is requested for a
+	// new root that doesn't contain all the entries of the old root.
+	ErrNotConsistent = errors.New("the new root doesn't contain all the entries of the old root")
+)
+
+// The types of the nodes of a ConsistencyProof.
+const (
+	// consistencyNodeMiddle is a middle node in both trees, followed by
+	// the nodes of its left and right children.
+	consistencyNodeMiddle byte = 0
+	// consistencyNodeShared is a subtree that is the same in both trees.
+	consistencyNodeShared byte = 1
+	// consistencyNodeAdded is a subtree of the new tree that is empty in
+	// the old one.
+	consistencyNodeAdded byte = 2
+	// consistencyNodeLeaf is a leaf of the old tree, which has been pushed
+	// down in the new tree.
+	consistencyNodeLeaf byte = 3
+)
+
+// consistencyProofHeaderLen is the length of the header of a serialized
+// ConsistencyProof: 1 byte for the hash kind and 4 bytes for the number of
+// nodes.
+const consistencyProofHeaderLen = 1 + 4
+
+// consistencyNode is a node of a ConsistencyProof.
+type consistencyNode struct {
+	typ byte
+	// key is the key of a shared or added subtree.
+	key *Hash
+	// leaf is the old leaf.
+	leaf *nodeAux
+	// numSiblings is the number of siblings of the path of the old leaf in
+	// the new tree, including the empty ones.
+	numSiblings uint
+	// notempties is a bitmap of non-empty siblings found in siblings.
+	notempties []byte
+	// siblings are the non-empty siblings of the path of the old leaf in
+	// the new tree, from top to bottom.
+	siblings []*Hash
+}
+
+// addSibling appends a sibling key to the path of the old leaf.
+func (n *consistencyNode) addSibling(key *Hash) {
+	if n.numSiblings/8 >= uint(len(n.notempties)) {
+		n.notempties = append(n.notempties, 0)
+	}
+	if !bytes.Equal(key[:], HashZero[:]) {
+		setBit(n.notempties, n.numSiblings)
+		n.siblings = append(n.siblings, key)
+	}
+	n.numSiblings++
+}
+
+// ConsistencyProof proves that all the entries of the tree with an old root
+// are in the tree with a new root unchanged, so that the new tree has only
+// added entries.  It contains the parts of the trees where they differ, from
+// the root down to the subtrees that are the same in both trees, the subtrees
+// that are empty in the old tree, and the leafs of the old tree that have
+// been pushed down in the new tree.
+type ConsistencyProof struct {
+	// nodes are the nodes of the proof in the order in which they are
+	// found traversing the trees depth first, left before right.
+	nodes []*consistencyNode
+	// HashKind is the kind of hash function of the MT of the proof.
+	HashKind HashKind
+}
+
+// NewConsistencyProofFromBytes parses a byte array into a ConsistencyProof.
+func NewConsistencyProofFromBytes(bs []byte) (*ConsistencyProof, error) {
+	if len(bs) < consistencyProofHeaderLen {
+		return nil, ErrInvalidProofBytes
+	}
+	p := &ConsistencyProof{HashKind: HashKind(bs[0])}
+	if _, err := p.HashKind.Hasher(); err != nil {
+		return nil, ErrInvalidProofBytes
+	}
+	numNodes := int(binary.BigEndian.Uint32(bs[1:consistencyProofHeaderLen]))
+	bs = bs[consistencyProofHeaderLen:]
+	readHash := func() (*Hash, bool) {
+		if len(bs) < ElemBytesLen {
+			return nil, false
+		}
+		var h Hash
+		copy(h[:], bs[:ElemBytesLen])
+		bs = bs[ElemBytesLen:]
+		return &h, true
+	}
+	for i := 0; i < numNodes; i++ {
+		if len(bs) < 1 {
+			return nil, ErrInvalidProofBytes
+		}
+		n := &consistencyNode{typ: bs[0]}
+		bs = bs[1:]
+		var ok bool
+		switch n.typ {
+		case consistencyNodeMiddle:
+		case consistencyNodeShared, consistencyNodeAdded:
+			if n.key, ok = readHash(); !ok {
+				return nil, ErrInvalidProofBytes
+			}
+		case consistencyNodeLeaf:
+			n.leaf = &nodeAux{}
+			if n.leaf.hIndex, ok = readHash(); !ok {
+				return nil, ErrInvalidProofBytes
+			}
+			if n.leaf.hValue, ok = readHash(); !ok {
+				return nil, ErrInvalidProofBytes
+			}
+			if len(bs) < 2 {
+				return nil, ErrInvalidProofBytes
+			}
+			n.numSiblings = uint(binary.BigEndian.Uint16(bs[:2]))
+			notemptiesLen := int((n.numSiblings + 7) / 8)
+			if len(bs) < 2+notemptiesLen {
+				return nil, ErrInvalidProofBytes
+			}
+			n.notempties = make([]byte, notemptiesLen)
+			copy(n.notempties, bs[2:2+notemptiesLen])
+			bs = bs[2+notemptiesLen:]
+			for j := uint(0); j < n.numSiblings; j++ {
+				if testBit(n.notempties, j) {
+					sib, ok := readHash()
+					if !ok {
+						return nil, ErrInvalidProofBytes
+					}
+					n.siblings = append(n.siblings, sib)
+				}
+			}
+		default:
+			return nil, ErrInvalidProofBytes
+		}
+		p.nodes = append(p.nodes, n)
+	}
+	if len(bs) != 0 {
+		return nil, ErrInvalidProofBytes
+	}
+	return p, nil
+}
+
+// Bytes serializes a ConsistencyProof into a byte array.
+func (p *ConsistencyProof) Bytes() []byte {
+	var buf bytes.Buffer
+	header := make([]byte, consistencyProofHeaderLen)
+	header[0] = byte(p.HashKind)
+	binary.BigEndian.PutUint32(header[1:consistencyProofHeaderLen], uint32(len(p.nodes)))
+	buf.Write(header)
+	for _, n := range p.nodes {
+		buf.WriteByte(n.typ)
+		switch n.typ {
+		case consistencyNodeShared, consistencyNodeAdded:
+			buf.Write(n.key[:])
+		case consistencyNodeLeaf:
+			buf.Write(n.leaf.hIndex[:])
+			buf.Write(n.leaf.hValue[:])
+			var numSiblings [2]byte
+			binary.BigEndian.PutUint16(numSiblings[:], uint16(n.numSiblings))
+			buf.Write(numSiblings[:])
+			buf.Write(n.notempties)
+			for _, sib := range n.siblings {
+				buf.Write(sib[:])
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func (p *ConsistencyProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(common3.HexEncode(p.Bytes()))
+}
+
+func (p *ConsistencyProof) UnmarshalJSON(bs []byte) error {
+	proofBytes, err := common3.UnmarshalJSONHexDecode(bs)
+	if err != nil {
+		return err
+	}
+	proof, err := NewConsistencyProofFromBytes(proofBytes)
+	if err != nil {
+		return err
+	}
+	*p = *proof
+	return nil
+}
+
+// generateLeafConsistencyProof adds to the ConsistencyProof the path of the
+// oldLeaf at level lvl in the new tree with keyNew at the same level.
+func (mt *MerkleTree) generateLeafConsistencyProof(p *ConsistencyProof, oldLeaf *Node,
+	keyNew *Hash, lvl int) error {
+	hIndex := oldLeaf.Entry.HIndexHasher(mt.hasher)
+	n := &consistencyNode{
+		typ:  consistencyNodeLeaf,
+		leaf: &nodeAux{hIndex: hIndex, hValue: oldLeaf.Entry.HValueHasher(mt.hasher)},
+	}
+	path := getPath(mt.maxLevels, hIndex)
+	oldKey := oldLeaf.Key()
+	for ; lvl < mt.maxLevels; lvl++ {
+		nNew, err := mt.GetNode(keyNew)
+		if err != nil {
+			return err
+		}
+		if nNew.Type != NodeTypeMiddle {
+			if bytes.Equal(keyNew[:], oldKey[:]) {
+				p.nodes = append(p.nodes, n)
+				return nil
+			}
+			return ErrNotConsistent
+		}
+		if path[lvl] {
+			n.addSibling(nNew.ChildL)
+			keyNew = nNew.ChildR
+		} else {
+			n.addSibling(nNew.ChildR)
+			keyNew = nNew.ChildL
+		}
+	}
+	return ErrReachedMaxLevel
+}
+
+// generateConsistencyProof recursively traverses the old and new trees from
+// the nodes with keyOld and keyNew at level lvl, and fills the
+// ConsistencyProof.
+func (mt *MerkleTree) generateConsistencyProof(p *ConsistencyProof, keyOld, keyNew *Hash, lvl int) error {
+	if bytes.Equal(keyOld[:], keyNew[:]) {
+		p.nodes = append(p.nodes, &consistencyNode{typ: consistencyNodeShared, key: keyNew})
+		return nil
+	}
+	if bytes.Equal(keyOld[:], HashZero[:]) {
+		p.nodes = append(p.nodes, &consistencyNode{typ: consistencyNodeAdded, key: keyNew})
+		return nil
+	}
+	if lvl > mt.maxLevels-1 {
+		return ErrReachedMaxLevel
+	}
+	nOld, err := mt.GetNode(keyOld)
+	if err != nil {
+		return err
+	}
+	switch nOld.Type {
+	case NodeTypeLeaf:
+		return mt.generateLeafConsistencyProof(p, nOld, keyNew, lvl)
+	case NodeTypeMiddle:
+		nNew, err := mt.GetNode(keyNew)
+		if err != nil {
+			return err
+		}
+		if nNew.Type != NodeTypeMiddle {
+			// The new tree has less than two entries where the old
+			// tree had at least two.
+			return ErrNotConsistent
+		}
+		p.nodes = append(p.nodes, &consistencyNode{typ: consistencyNodeMiddle})
+		if err := mt.generateConsistencyProof(p, nOld.ChildL, nNew.ChildL, lvl+1); err != nil {
+			return err
+		}
+		return mt.generateConsistencyProof(p, nOld.ChildR, nNew.ChildR, lvl+1)
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// GenerateConsistencyProof generates a proof that all the entries of the tree
+// with oldRoot are in the tree with newRoot unchanged.  If the tree with
+// newRoot has removed or updated any entry of the tree with oldRoot,
+// ErrNotConsistent is returned.  If the newRoot is nil, the current
+// merkletree root is used.
+func (mt *MerkleTree) GenerateConsistencyProof(oldRoot, newRoot *Hash) (*ConsistencyProof, error) {
+	if newRoot == nil {
+		newRoot = mt.RootKey()
+	}
+	p := &ConsistencyProof{HashKind: mt.hasher.Kind()}
+	if err := mt.generateConsistencyProof(p, oldRoot, newRoot, 0); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// consistencyVerifier holds the state of the verification of a
+// ConsistencyProof.
+type consistencyVerifier struct {
+	proof  *ConsistencyProof
+	hasher Hasher
+	// next is the position of the next node of the proof.
+	next int
+}
+
+// leafKeys returns the keys of the old leaf n at level lvl in the old and new
+// trees.
+func (v *consistencyVerifier) leafKeys(n *consistencyNode, lvl uint, path []bool) (*Hash, *Hash, bool) {
+	// The old leaf must be in the path of its hIndex
+	for l, right := range path {
+		if testBitBigEndian(n.leaf.hIndex[:], uint(l)) != right {
+			return nil, nil, false
+		}
+	}
+	if lvl+n.numSiblings > checkMaxLevels {
+		return nil, nil, false
+	}
+	siblings := make([]*Hash, n.numSiblings)
+	sibIdx := 0
+	for i := range siblings {
+		if testBit(n.notempties, uint(i)) {
+			if sibIdx >= len(n.siblings) {
+				return nil, nil, false
+			}
+			siblings[i] = n.siblings[sibIdx]
+			sibIdx++
+		} else {
+			siblings[i] = &HashZero
+		}
+	}
+	if sibIdx != len(n.siblings) {
+		return nil, nil, false
+	}
+	keyOld := leafKeyHasher(v.hasher, n.leaf.hIndex, n.leaf.hValue)
+	keyNew := keyOld
+	for i := len(siblings) - 1; i >= 0; i-- {
+		if testBitBigEndian(n.leaf.hIndex[:], lvl+uint(i)) {
+			keyNew = newNodeMiddleHasher(v.hasher, siblings[i], keyNew).Key()
+		} else {
+			keyNew = newNodeMiddleHasher(v.hasher, keyNew, siblings[i]).Key()
+		}
+	}
+	return keyOld, keyNew, true
+}
+
+// nodeKeys recursively computes the keys of the nodes at level lvl with the
+// given path in the old and new trees.
+func (v *consistencyVerifier) nodeKeys(lvl uint, path []bool) (*Hash, *Hash, bool) {
+	if v.next >= len(v.proof.nodes) {
+		return nil, nil, false
+	}
+	n := v.proof.nodes[v.next]
+	v.next++
+	switch n.typ {
+	case consistencyNodeShared:
+		return n.key, n.key, true
+	case consistencyNodeAdded:
+		return &HashZero, n.key, true
+	case consistencyNodeLeaf:
+		return v.leafKeys(n, lvl, path)
+	case consistencyNodeMiddle:
+		if lvl >= checkMaxLevels-1 {
+			return nil, nil, false
+		}
+		oldL, newL, ok := v.nodeKeys(lvl+1, append(path, false))
+		if !ok {
+			return nil, nil, false
+		}
+		oldR, newR, ok := v.nodeKeys(lvl+1, append(path, true))
+		if !ok {
+			return nil, nil, false
+		}
+		return newNodeMiddleHasher(v.hasher, oldL, oldR).Key(),
+			newNodeMiddleHasher(v.hasher, newL, newR).Key(), true
+	default:
+		return nil, nil, false
+	}
+}
+
+// VerifyConsistencyProof verifies that the ConsistencyProof proves that all
+// the entries of the tree with oldRoot are in the tree with newRoot
+// unchanged.
+func VerifyConsistencyProof(oldRoot, newRoot *Hash, proof *ConsistencyProof) bool {
+	hasher, err := proof.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
+	v := consistencyVerifier{proof: proof, hasher: hasher}
+	keyOld, keyNew, ok := v.nodeKeys(0, []bool{})
+	if !ok || v.next != len(proof.nodes) {
+		return false
+	}
+	return bytes.Equal(keyOld[:], oldRoot[:]) && bytes.Equal(keyNew[:], newRoot[:])
+}
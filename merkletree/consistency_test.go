@@ -0,0 +1,131 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsistencyProof(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	roots := []*Hash{mt.RootKey()}
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		if i%16 == 0 {
+			roots = append(roots, mt.RootKey())
+		}
+	}
+	roots = append(roots, mt.RootKey())
+
+	for i, oldRoot := range roots {
+		for _, newRoot := range roots[i:] {
+			proof, err := mt.GenerateConsistencyProof(oldRoot, newRoot)
+			assert.Nil(t, err)
+			assert.True(t, VerifyConsistencyProof(oldRoot, newRoot, proof))
+
+			proofBytes := proof.Bytes()
+			proof2, err := NewConsistencyProofFromBytes(proofBytes)
+			assert.Nil(t, err)
+			assert.Equal(t, proofBytes, proof2.Bytes())
+			assert.True(t, VerifyConsistencyProof(oldRoot, newRoot, proof2))
+
+			if oldRoot != newRoot {
+				assert.False(t, VerifyConsistencyProof(newRoot, oldRoot, proof))
+			}
+		}
+	}
+
+	// Some old leafs have been pushed down in the new tree
+	proof, err := mt.GenerateConsistencyProof(roots[2], nil)
+	assert.Nil(t, err)
+	leafs := 0
+	for _, n := range proof.nodes {
+		if n.typ == consistencyNodeLeaf {
+			leafs++
+		}
+	}
+	assert.NotEqual(t, 0, leafs)
+	assert.False(t, VerifyConsistencyProof(roots[1], mt.RootKey(), proof))
+	assert.False(t, VerifyConsistencyProof(roots[2], roots[3], proof))
+
+	proofJSON, err := json.Marshal(proof)
+	assert.Nil(t, err)
+	var proof2 ConsistencyProof
+	assert.Nil(t, json.Unmarshal(proofJSON, &proof2))
+	assert.True(t, VerifyConsistencyProof(roots[2], mt.RootKey(), &proof2))
+}
+
+func TestConsistencyProofNotConsistent(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRoot := mt.RootKey()
+
+	e := NewEntryFromInts(1, 3, 0, 3)
+	_, updatedRoot, err := mt.Update(&e)
+	assert.Nil(t, err)
+	_, err = mt.GenerateConsistencyProof(oldRoot, updatedRoot)
+	assert.Equal(t, ErrNotConsistent, err)
+
+	assert.Nil(t, mt.Delete(e.HIndex()))
+	_, err = mt.GenerateConsistencyProof(oldRoot, nil)
+	assert.Equal(t, ErrNotConsistent, err)
+	e = NewEntryFromInts(0, 100, 0, 100)
+	assert.Nil(t, mt.Add(&e))
+	_, err = mt.GenerateConsistencyProof(oldRoot, nil)
+	assert.Equal(t, ErrNotConsistent, err)
+
+	// Once the entry is restored the new tree is consistent, but a proof
+	// where an old leaf is replaced is not valid
+	e = NewEntryFromInts(0, 3, 0, 3)
+	assert.Nil(t, mt.Add(&e))
+	e = NewEntryFromInts(0, 200, 0, 200)
+	assert.Nil(t, mt.Add(&e))
+	proof, err := mt.GenerateConsistencyProof(oldRoot, nil)
+	assert.Nil(t, err)
+	assert.True(t, VerifyConsistencyProof(oldRoot, mt.RootKey(), proof))
+	eBad := NewEntryFromInts(1, 3, 0, 3)
+	for _, n := range proof.nodes {
+		if n.typ == consistencyNodeLeaf {
+			n.leaf.hValue = eBad.HValue()
+			break
+		}
+	}
+	assert.False(t, VerifyConsistencyProof(oldRoot, mt.RootKey(), proof))
+}
+
+func TestConsistencyProofInvalidBytes(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	oldRoot := mt.RootKey()
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			oldRoot = mt.RootKey()
+		}
+	}
+	proof, err := mt.GenerateConsistencyProof(oldRoot, nil)
+	assert.Nil(t, err)
+	proofBytes := proof.Bytes()
+
+	for i := 0; i < len(proofBytes); i++ {
+		_, err := NewConsistencyProofFromBytes(proofBytes[:i])
+		assert.Equal(t, ErrInvalidProofBytes, err)
+	}
+	_, err = NewConsistencyProofFromBytes(append(proofBytes, 0))
+	assert.Equal(t, ErrInvalidProofBytes, err)
+}
@@ -0,0 +1,99 @@
+package merkletree
+
+import (
+	"bytes"
+)
+
+// EntryChange is an entry whose value has changed between two roots.
+type EntryChange struct {
+	Old *Entry
+	New *Entry
+}
+
+// TreeDiff contains the leaf entries that differ between two roots of a
+// MerkleTree.  The entries of each list are sorted by their path in the tree.
+type TreeDiff struct {
+	// Added are the entries whose index is only found in the new root.
+	Added []*Entry
+	// Removed are the entries whose index is only found in the old root.
+	Removed []*Entry
+	// Changed are the entries whose index is found in both roots with a
+	// different value.
+	Changed []EntryChange
+}
+
+// splitNode returns the keys of the children of a node at level lvl.  A leaf
+// (or empty) node that is compared against a middle node is treated as if it
+// was pushed down its path, which doesn't change its key.
+func (mt *MerkleTree) splitNode(n *Node, key *Hash, lvl int) (*Hash, *Hash) {
+	switch n.Type {
+	case NodeTypeMiddle:
+		return n.ChildL, n.ChildR
+	case NodeTypeLeaf:
+		if testBitBigEndian(n.Entry.HIndexHasher(mt.hasher)[:], uint(lvl)) {
+			return &HashZero, key
+		}
+		return key, &HashZero
+	default:
+		return &HashZero, &HashZero
+	}
+}
+
+// diff recursively compares the subtrees with keys keyOld and keyNew at level
+// lvl, skipping the identical subtrees, and adds the differences to d.
+func (mt *MerkleTree) diff(keyOld, keyNew *Hash, lvl int, d *TreeDiff) error {
+	if bytes.Equal(keyOld[:], keyNew[:]) {
+		return nil
+	}
+	if lvl > mt.maxLevels-1 {
+		return ErrReachedMaxLevel
+	}
+	nOld, err := mt.GetNode(keyOld)
+	if err != nil {
+		return err
+	}
+	nNew, err := mt.GetNode(keyNew)
+	if err != nil {
+		return err
+	}
+	if nOld.Type == NodeTypeMiddle || nNew.Type == NodeTypeMiddle {
+		oldL, oldR := mt.splitNode(nOld, keyOld, lvl)
+		newL, newR := mt.splitNode(nNew, keyNew, lvl)
+		if err := mt.diff(oldL, newL, lvl+1, d); err != nil {
+			return err
+		}
+		return mt.diff(oldR, newR, lvl+1, d)
+	}
+	// Both nodes are either a leaf or empty, and they are not equal
+	switch {
+	case nOld.Type == NodeTypeLeaf && nNew.Type == NodeTypeLeaf:
+		hIndexOld := nOld.Entry.HIndexHasher(mt.hasher)
+		hIndexNew := nNew.Entry.HIndexHasher(mt.hasher)
+		if bytes.Equal(hIndexOld[:], hIndexNew[:]) {
+			d.Changed = append(d.Changed, EntryChange{Old: nOld.Entry, New: nNew.Entry})
+		} else {
+			d.Removed = append(d.Removed, nOld.Entry)
+			d.Added = append(d.Added, nNew.Entry)
+		}
+	case nOld.Type == NodeTypeLeaf:
+		d.Removed = append(d.Removed, nOld.Entry)
+	case nNew.Type == NodeTypeLeaf:
+		d.Added = append(d.Added, nNew.Entry)
+	}
+	return nil
+}
+
+// Diff returns the leaf entries that have been added, removed and changed
+// from the tree with root oldRoot to the tree with root newRoot.  Both trees
+// are traversed in parallel, skipping the subtrees with the same key.
+// If newRoot is nil, the current merkletree root is used
+func (mt *MerkleTree) Diff(oldRoot, newRoot *Hash) (*TreeDiff, error) {
+	if newRoot == nil {
+		newRoot = mt.RootKey()
+	}
+	d := &TreeDiff{}
+	if err := mt.diff(oldRoot, newRoot, 0, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,115 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func entriesData(entries []*Entry) []Data {
+	data := []Data{}
+	for _, e := range entries {
+		data = append(data, e.Data)
+	}
+	return data
+}
+
+func TestDiff(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRoot := mt.RootKey()
+
+	for i := 16; i < 20; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e3 := NewEntryFromInts(0, 3, 0, 3)
+	assert.Nil(t, mt.Delete(e3.HIndex()))
+	e5 := NewEntryFromInts(0, 5, 0, 5)
+	e5Updated := NewEntryFromInts(1, 55, 0, 5)
+	_, _, err := mt.Update(&e5Updated)
+	assert.Nil(t, err)
+
+	d, err := mt.Diff(oldRoot, nil)
+	assert.Nil(t, err)
+	added := []Data{}
+	for i := 16; i < 20; i++ {
+		added = append(added, IntsToData(0, int64(i), 0, int64(i)))
+	}
+	assert.ElementsMatch(t, added, entriesData(d.Added))
+	assert.Equal(t, []Data{e3.Data}, entriesData(d.Removed))
+	assert.Equal(t, 1, len(d.Changed))
+	assert.Equal(t, e5.Data, d.Changed[0].Old.Data)
+	assert.Equal(t, e5Updated.Data, d.Changed[0].New.Data)
+
+	// The reverse diff
+	d, err = mt.Diff(mt.RootKey(), oldRoot)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, added, entriesData(d.Removed))
+	assert.Equal(t, []Data{e3.Data}, entriesData(d.Added))
+	assert.Equal(t, 1, len(d.Changed))
+	assert.Equal(t, e5Updated.Data, d.Changed[0].Old.Data)
+	assert.Equal(t, e5.Data, d.Changed[0].New.Data)
+
+	// No differences
+	d, err = mt.Diff(oldRoot, oldRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, &TreeDiff{}, d)
+}
+
+func TestDiffFromEmpty(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	data := []Data{}
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, e.Data)
+	}
+
+	d, err := mt.Diff(&HashZero, nil)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, data, entriesData(d.Added))
+	assert.Equal(t, 0, len(d.Removed))
+	assert.Equal(t, 0, len(d.Changed))
+
+	d, err = mt.Diff(mt.RootKey(), &HashZero)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, data, entriesData(d.Removed))
+	assert.Equal(t, 0, len(d.Added))
+}
+
+func TestDiffSingleLeaf(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	// The old tree is a single leaf that ends up deep in the new tree
+	e0 := NewEntryFromInts(0, 0, 0, 0)
+	assert.Nil(t, mt.Add(&e0))
+	oldRoot := mt.RootKey()
+	e0Updated := NewEntryFromInts(0, 1, 0, 0)
+	_, _, err := mt.Update(&e0Updated)
+	assert.Nil(t, err)
+	e4 := NewEntryFromInts(0, 4, 0, 4)
+	assert.Nil(t, mt.Add(&e4))
+
+	d, err := mt.Diff(oldRoot, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Data{e4.Data}, entriesData(d.Added))
+	assert.Equal(t, 0, len(d.Removed))
+	assert.Equal(t, 1, len(d.Changed))
+	assert.Equal(t, e0.Data, d.Changed[0].Old.Data)
+	assert.Equal(t, e0Updated.Data, d.Changed[0].New.Data)
+}
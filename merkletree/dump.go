@@ -0,0 +1,393 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+const (
+	// dumpVersion is the version of the binary dump format.
+	dumpVersion = 1
+	// dumpHeaderLen is the length of the header of a binary dump: magic,
+	// version, hash kind, maxLevels and root.
+	dumpHeaderLen = 4 + 1 + 1 + 4 + ElemBytesLen
+)
+
+var (
+	// dumpMagic are the first bytes of a binary dump.
+	dumpMagic = []byte("MTDB")
+
+	// ErrInvalidDump is used when a binary dump is malformed.
+	ErrInvalidDump = errors.New("invalid merkletree dump")
+	// ErrDumpVersion is used when the version of a binary dump is not
+	// supported.
+	ErrDumpVersion = errors.New("unsupported merkletree dump version")
+	// ErrDumpChecksum is used when the checksum of a binary dump doesn't
+	// match its content.
+	ErrDumpChecksum = errors.New("the merkletree dump checksum doesn't match")
+	// ErrDumpRootMismatch is used when the root of the MT after importing
+	// a binary dump doesn't match the root of the dump.
+	ErrDumpRootMismatch = errors.New("the merkletree root doesn't match the root of the dump")
+	// ErrDumpMaxLevels is used when the maxLevels of a binary dump doesn't
+	// match the one of the MT where it's imported.
+	ErrDumpMaxLevels = errors.New("the maxLevels of the merkletree doesn't match the one of the dump")
+	// ErrDumpTargetNotEmpty is used when a binary dump is imported into a
+	// MT that is not empty.
+	ErrDumpTargetNotEmpty = errors.New("the merkletree where the dump is imported is not empty")
+)
+
+// DumpHeader is the header of a binary dump of a MT.
+type DumpHeader struct {
+	Version   byte
+	HashKind  HashKind
+	MaxLevels int
+	Root      *Hash
+}
+
+// walkLeaves calls f for each leaf of the tree with the given key, stopping
+// at the first error.
+func (mt *MerkleTree) walkLeaves(key *Hash, f func(*Node) error) error {
+	n, err := mt.GetNode(key)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case NodeTypeEmpty:
+		return nil
+	case NodeTypeLeaf:
+		return f(n)
+	case NodeTypeMiddle:
+		if err := mt.walkLeaves(n.ChildL, f); err != nil {
+			return err
+		}
+		return mt.walkLeaves(n.ChildR, f)
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// DumpBinary writes to w a binary dump of all the entries of the MT with the
+// given rootKey.  If rootKey is nil, the current root is used.
+//
+// The dump consists of a header (the magic "MTDB", the format version, the
+// hash kind, the maxLevels as a big endian uint32 and the root), followed by
+// each entry prefixed by its length as a big endian uint32, in the order of
+// their paths from left to right, a zero length that marks the end of the
+// entries, and the sha256 checksum of all the previous bytes.
+func (mt *MerkleTree) DumpBinary(w io.Writer, rootKey *Hash) error {
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	bw := bufio.NewWriter(w)
+	h := sha256.New()
+	mw := io.MultiWriter(bw, h)
+
+	header := make([]byte, 0, dumpHeaderLen)
+	header = append(header, dumpMagic...)
+	header = append(header, dumpVersion, byte(mt.hasher.Kind()))
+	var maxLevels [4]byte
+	binary.BigEndian.PutUint32(maxLevels[:], uint32(mt.maxLevels))
+	header = append(header, maxLevels[:]...)
+	header = append(header, rootKey[:]...)
+	if _, err := mw.Write(header); err != nil {
+		return err
+	}
+
+	err := mt.walkLeaves(rootKey, func(n *Node) error {
+		b := n.Entry.Bytes()
+		if err := binary.Write(mw, binary.BigEndian, uint32(len(b))); err != nil {
+			return err
+		}
+		_, err := mw.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(mw, binary.BigEndian, uint32(0)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(h.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// dumpReader reads the entries of a binary dump, verifying its checksum once
+// all of them have been read.
+type dumpReader struct {
+	r  io.Reader
+	tr io.Reader
+	h  hash.Hash
+	// end indicates that all the entries have been read and the checksum
+	// verified.
+	end bool
+	// err is the error found reading the dump, after which it can't be
+	// read anymore.
+	err error
+}
+
+// newDumpReader reads the header of the binary dump from r, returning it with
+// a dumpReader of its entries.
+func newDumpReader(r io.Reader) (*dumpReader, *DumpHeader, error) {
+	h := sha256.New()
+	d := &dumpReader{r: r, tr: io.TeeReader(r, h), h: h}
+
+	header := make([]byte, dumpHeaderLen)
+	if _, err := io.ReadFull(d.tr, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:len(dumpMagic)], dumpMagic) {
+		return nil, nil, ErrInvalidDump
+	}
+	header = header[len(dumpMagic):]
+	dh := &DumpHeader{
+		Version:   header[0],
+		HashKind:  HashKind(header[1]),
+		MaxLevels: int(binary.BigEndian.Uint32(header[2:6])),
+		Root:      &Hash{},
+	}
+	copy(dh.Root[:], header[6:])
+	if dh.Version != dumpVersion {
+		return nil, nil, ErrDumpVersion
+	}
+	return d, dh, nil
+}
+
+// next returns the next entry of the dump, or nil once all the entries have
+// been read and the checksum of the dump has been verified.
+func (d *dumpReader) next() (*Entry, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.end {
+		return nil, nil
+	}
+	e, err := d.readEntry()
+	if err != nil {
+		d.err = err
+		return nil, err
+	}
+	return e, nil
+}
+
+// readEntry reads the next entry of the dump, or the checksum after the last
+// one.
+func (d *dumpReader) readEntry() (*Entry, error) {
+	var length uint32
+	if err := binary.Read(d.tr, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		sum := d.h.Sum(nil)
+		checksum := make([]byte, len(sum))
+		if _, err := io.ReadFull(d.r, checksum); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(sum, checksum) {
+			return nil, ErrDumpChecksum
+		}
+		d.end = true
+		return nil, nil
+	}
+	if length != ElemBytesLen*DataLen {
+		return nil, ErrInvalidDump
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(d.tr, b); err != nil {
+		return nil, err
+	}
+	return NewEntryFromBytes(b)
+}
+
+// drain reads the rest of the entries of the dump, verifying its checksum.
+func (d *dumpReader) drain() error {
+	for {
+		e, err := d.next()
+		if err != nil || e == nil {
+			return err
+		}
+	}
+}
+
+// dumpLeaf is an entry of a binary dump being imported, with its hIndex and
+// path.
+type dumpLeaf struct {
+	entry  *Entry
+	hIndex *Hash
+	path   []bool
+}
+
+// dumpImporter builds the tree of the entries of a binary dump as they are
+// read.  The entries of a dump are sorted by their path, so every subtree is
+// complete, and stored, once the entries that follow it have a different path
+// prefix: only the current entry and the next one are kept in memory.
+type dumpImporter struct {
+	mt *MerkleTree
+	tx db.Tx
+	d  *dumpReader
+	// stats are the counters of the imported tree.
+	stats *treeStats
+	// cur is the entry being imported and next the one that follows it.
+	cur, next *dumpLeaf
+}
+
+// advance moves to the next entry of the dump.
+func (im *dumpImporter) advance() error {
+	im.cur = im.next
+	e, err := im.d.next()
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		im.next = nil
+		return nil
+	}
+	if err := checkEntryInField(e); err != nil {
+		return err
+	}
+	hIndex := e.HIndexHasher(im.mt.hasher)
+	im.next = &dumpLeaf{entry: e, hIndex: hIndex, path: getPath(im.mt.maxLevels, hIndex)}
+	return nil
+}
+
+// samePrefix returns true if the paths a and b are the same up to lvl.
+func samePrefix(a, b []bool, lvl int) bool {
+	for i := 0; i < lvl; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// subtree stores the subtree at depth lvl with the current entry and the
+// following ones whose path starts like the one of the current entry up to
+// lvl, and returns its key.
+func (im *dumpImporter) subtree(lvl int) (*Hash, error) {
+	cur := im.cur
+	if im.next == nil || !samePrefix(cur.path, im.next.path, lvl) {
+		// The current entry is the only one in the subtree
+		n := newNodeLeafHasher(im.mt.hasher, cur.entry)
+		im.stats.addLeaf(n, lvl)
+		if err := im.advance(); err != nil {
+			return nil, err
+		}
+		return im.mt.addNode(im.tx, n)
+	}
+	if bytes.Equal(cur.hIndex[:], im.next.hIndex[:]) {
+		return nil, ErrEntryIndexAlreadyExists
+	}
+	if lvl > im.mt.maxLevels-2 {
+		return nil, ErrReachedMaxLevel
+	}
+	keyL, keyR := &HashZero, &HashZero
+	var err error
+	if !cur.path[lvl] {
+		if keyL, err = im.subtree(lvl + 1); err != nil {
+			return nil, err
+		}
+	}
+	if im.cur != nil && samePrefix(cur.path, im.cur.path, lvl) && im.cur.path[lvl] {
+		if keyR, err = im.subtree(lvl + 1); err != nil {
+			return nil, err
+		}
+	}
+	im.stats.middles++
+	return im.mt.addNode(im.tx, newNodeMiddleHasher(im.mt.hasher, keyL, keyR))
+}
+
+// root stores the tree of all the entries of the dump, and returns its root
+// key.
+func (im *dumpImporter) root() (*Hash, error) {
+	// Read the first entry into cur
+	if err := im.advance(); err != nil {
+		return nil, err
+	}
+	if err := im.advance(); err != nil {
+		return nil, err
+	}
+	if im.cur == nil {
+		return &HashZero, nil
+	}
+	root, err := im.subtree(0)
+	if err != nil {
+		return nil, err
+	}
+	if im.cur != nil {
+		// The entries are not sorted by their path
+		return nil, ErrInvalidDump
+	}
+	return root, nil
+}
+
+// ImportBinary imports into the MT all the entries of the binary dump read
+// from r (see DumpBinary), in a single transaction, returning the header of
+// the dump.  The MT must be empty, and have the hash function and the
+// maxLevels of the dump.  The nodes are built as the entries are read, without
+// keeping the entries in memory, but they are only added if the checksum of
+// the dump is valid and the resulting root of the MT matches the root of the
+// dump.
+func (mt *MerkleTree) ImportBinary(r io.Reader) (*DumpHeader, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	d, dh, err := newDumpReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if dh.HashKind != mt.hasher.Kind() {
+		return nil, ErrHashKindMismatch
+	}
+	if dh.MaxLevels != mt.maxLevels {
+		return nil, ErrDumpMaxLevels
+	}
+
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return nil, err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+	if !bytes.Equal(mt.rootKey[:], HashZero[:]) {
+		err = ErrDumpTargetNotEmpty
+		return nil, err
+	}
+
+	im := dumpImporter{mt: mt, tx: tx, d: d, stats: newTreeStats()}
+	newRootKey, err := im.root()
+	if err != nil {
+		// A corrupted dump is reported as such, even if it's
+		// found to be invalid before reaching the checksum.
+		if d.drain() == ErrDumpChecksum {
+			err = ErrDumpChecksum
+		}
+		return nil, err
+	}
+	if !bytes.Equal(newRootKey[:], dh.Root[:]) {
+		err = ErrDumpRootMismatch
+		return nil, err
+	}
+	mt.dbInsert(tx, statsValue, DBEntryTypeStats, im.stats.bytes(newRootKey))
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return nil, err
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return dh, nil
+}
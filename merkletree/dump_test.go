@@ -0,0 +1,171 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpBinary(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	var root32 *Hash
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		if i == 31 {
+			root32 = mt.RootKey()
+		}
+	}
+
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+	assert.Equal(t, dumpHeaderLen+64*(4+ElemBytesLen*DataLen)+4+32, dump.Len())
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	dh, err := mt2.ImportBinary(bytes.NewReader(dump.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, &DumpHeader{Version: dumpVersion, HashKind: HashKindPoseidon,
+		MaxLevels: 140, Root: mt.RootKey()}, dh)
+	assert.Equal(t, mt.RootKey(), mt2.RootKey())
+
+	// The dump of an older root
+	dump.Reset()
+	assert.Nil(t, mt.DumpBinary(&dump, root32))
+	mt3 := newTestingMerkle(t, 140)
+	defer mt3.Storage().Close()
+	_, err = mt3.ImportBinary(&dump)
+	assert.Nil(t, err)
+	assert.Equal(t, root32, mt3.RootKey())
+}
+
+func TestDumpBinaryEmpty(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	_, err := mt2.ImportBinary(&dump)
+	assert.Nil(t, err)
+	assert.Equal(t, HashZero, *mt2.RootKey())
+}
+
+func TestImportBinaryInvalid(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+	b := dump.Bytes()
+
+	importDump := func(b []byte) error {
+		mt2 := newTestingMerkle(t, 140)
+		defer mt2.Storage().Close()
+		_, err := mt2.ImportBinary(bytes.NewReader(b))
+		if err != nil {
+			// Nothing has been imported
+			assert.Equal(t, HashZero, *mt2.RootKey())
+			assert.Equal(t, 0, countStoredNodes(t, mt2))
+		}
+		return err
+	}
+	modify := func(i int, v byte) []byte {
+		bm := append([]byte{}, b...)
+		bm[i] = v
+		return bm
+	}
+
+	assert.Equal(t, ErrInvalidDump, importDump(modify(0, 'X')))
+	assert.Equal(t, ErrDumpVersion, importDump(modify(4, 2)))
+	// The header is checked before reading the entries
+	assert.Equal(t, ErrHashKindMismatch, importDump(modify(5, byte(HashKindMimc7))))
+	assert.Equal(t, ErrDumpMaxLevels, importDump(modify(9, 141)))
+	assert.Equal(t, ErrDumpChecksum, importDump(modify(dumpHeaderLen-1, 0xff)))
+	assert.Equal(t, ErrDumpChecksum, importDump(modify(dumpHeaderLen+10, 0xff)))
+	assert.Equal(t, ErrDumpChecksum, importDump(modify(len(b)-1, b[len(b)-1]^0xff)))
+	assert.NotNil(t, importDump(b[:len(b)-1]))
+
+	// A dump whose root doesn't match its entries, with a valid checksum
+	bm := append([]byte{}, b[:len(b)-32]...)
+	copy(bm[dumpHeaderLen-ElemBytesLen:], HashZero[:])
+	checksum := sha256.Sum256(bm)
+	assert.Equal(t, ErrDumpRootMismatch, importDump(append(bm, checksum[:]...)))
+
+	// A dump whose entries are not sorted by their path, with a valid
+	// checksum
+	entryLen := 4 + ElemBytesLen*DataLen
+	bm = append([]byte{}, b[:len(b)-32]...)
+	first := append([]byte{}, bm[dumpHeaderLen:dumpHeaderLen+entryLen]...)
+	copy(bm[dumpHeaderLen:], bm[dumpHeaderLen+entryLen:dumpHeaderLen+2*entryLen])
+	copy(bm[dumpHeaderLen+entryLen:], first)
+	checksum = sha256.Sum256(bm)
+	assert.Equal(t, ErrInvalidDump, importDump(append(bm, checksum[:]...)))
+
+	// A dump of a MT with a different hash function
+	mtMimc7, err := NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	e := NewEntryFromInts(0, 1, 0, 1)
+	assert.Nil(t, mtMimc7.Add(&e))
+	dump.Reset()
+	assert.Nil(t, mtMimc7.DumpBinary(&dump, nil))
+	assert.Equal(t, ErrHashKindMismatch, importDump(dump.Bytes()))
+}
+
+func TestImportBinaryNotEmpty(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	e := NewEntryFromInts(0, 1, 0, 1)
+	assert.Nil(t, mt.Add(&e))
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	e2 := NewEntryFromInts(0, 2, 0, 2)
+	assert.Nil(t, mt2.Add(&e2))
+	root := mt2.RootKey()
+	_, err := mt2.ImportBinary(&dump)
+	assert.Equal(t, ErrDumpTargetNotEmpty, err)
+	assert.Equal(t, root, mt2.RootKey())
+}
+
+func TestImportBinaryStats(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 100; i++ {
+		e := NewEntryFromInts(0, 0, int64(i), int64(i%7))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+	sto := db.NewMemoryStorage()
+	mt2, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	defer mt2.Storage().Close()
+	_, err = mt2.ImportBinary(&dump)
+	assert.Nil(t, err)
+	assert.Equal(t, mt.RootKey(), mt2.RootKey())
+	stats, err := mt.Stats()
+	assert.Nil(t, err)
+	stats2, err := mt2.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, stats2)
+	report, err := Check(sto, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Ok())
+}
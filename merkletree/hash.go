@@ -0,0 +1,121 @@
+package merkletree
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/iden3/go-iden3-crypto/mimc7"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+)
+
+// HashKind identifies the hash function used to compute the hashes of a MT.
+type HashKind byte
+
+const (
+	// HashKindPoseidon indicates the Poseidon hash function.  This is the
+	// hash function used by default.
+	HashKindPoseidon HashKind = 0
+	// HashKindMimc7 indicates the MiMC7 hash function.
+	HashKindMimc7 HashKind = 1
+
+	// hashKindsLen is the number of kinds of hash functions.
+	hashKindsLen = 2
+)
+
+var (
+	// ErrInvalidHashKind is used when the kind of hash function is unknown.
+	ErrInvalidHashKind = errors.New("invalid hash kind")
+	// ErrHashKindMismatch is used when a MerkleTree is opened with a hash
+	// function different from the one recorded in the storage.
+	ErrHashKindMismatch = errors.New("the hash kind doesn't match the one of the merkle tree")
+)
+
+// Hasher is the hash function used to compute the hashes of a MT.
+type Hasher interface {
+	// Kind returns the kind of the hash function.
+	Kind() HashKind
+	// HashElems performs the hash over the array of ElemBytes.
+	HashElems(elems ...ElemBytes) *Hash
+	// HashElemsKey performs the hash over the array of ElemBytes with a key.
+	HashElemsKey(key *big.Int, elems ...ElemBytes) *Hash
+}
+
+var (
+	// HasherPoseidon is the Hasher that uses the Poseidon hash function.
+	HasherPoseidon Hasher = hasherPoseidon{}
+	// HasherMimc7 is the Hasher that uses the MiMC7 hash function.
+	HasherMimc7 Hasher = hasherMimc7{}
+)
+
+// Hasher returns the Hasher of the kind of hash function.
+func (k HashKind) Hasher() (Hasher, error) {
+	switch k {
+	case HashKindPoseidon:
+		return HasherPoseidon, nil
+	case HashKindMimc7:
+		return HasherMimc7, nil
+	default:
+		return nil, ErrInvalidHashKind
+	}
+}
+
+// String returns the name of the kind of hash function.
+func (k HashKind) String() string {
+	switch k {
+	case HashKindPoseidon:
+		return "poseidon"
+	case HashKindMimc7:
+		return "mimc7"
+	default:
+		return "unknown"
+	}
+}
+
+type hasherPoseidon struct{}
+
+func (h hasherPoseidon) Kind() HashKind {
+	return HashKindPoseidon
+}
+
+// HashElems performs a poseidon hash over the array of ElemBytes.
+func (h hasherPoseidon) HashElems(elems ...ElemBytes) *Hash {
+	return h.HashElemsKey(nil, elems...)
+}
+
+// HashElemsKey performs a poseidon hash over the array of ElemBytes, with the
+// key as the first element.
+func (h hasherPoseidon) HashElemsKey(key *big.Int, elems ...ElemBytes) *Hash {
+	bigints := ElemBytesToBigInts(elems...)
+	if key != nil {
+		bigints = append([]*big.Int{key}, bigints...)
+	}
+	poseidonHash, err := poseidon.Hash(bigints)
+	if err != nil {
+		panic(err)
+	}
+	hash := BigIntToHash(poseidonHash)
+	return &hash
+}
+
+type hasherMimc7 struct{}
+
+func (h hasherMimc7) Kind() HashKind {
+	return HashKindMimc7
+}
+
+// HashElems performs a mimc7 hash over the array of ElemBytes.
+func (h hasherMimc7) HashElems(elems ...ElemBytes) *Hash {
+	return h.HashElemsKey(nil, elems...)
+}
+
+// HashElemsKey performs a mimc7 hash over the array of ElemBytes using key as
+// the mimc7 key.
+func (h hasherMimc7) HashElemsKey(key *big.Int, elems ...ElemBytes) *Hash {
+	bigints := ElemBytesToBigInts(elems...)
+	mimcHash, err := mimc7.Hash(bigints, key)
+	if err != nil {
+		panic(err)
+	}
+	hash := BigIntToHash(mimcHash)
+	return &hash
+}
@@ -0,0 +1,145 @@
+package merkletree
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashKindStored(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTreeHash(sto, 140, HashKindMimc7)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+	assert.Equal(t, HashKindMimc7, mt.HashKind())
+
+	e := NewEntryFromInts(12, 45, 78, 41)
+	assert.Nil(t, mt.Add(&e))
+
+	// Reopening the MerkleTree uses the stored hash function
+	mtReopened, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, HashKindMimc7, mtReopened.HashKind())
+	assert.Equal(t, mt.RootKey(), mtReopened.RootKey())
+
+	_, err = NewMerkleTreeHash(sto, 140, HashKindPoseidon)
+	assert.Equal(t, ErrHashKindMismatch, err)
+
+	_, err = NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKind(9))
+	assert.Equal(t, ErrInvalidHashKind, err)
+}
+
+func TestHashKindDefault(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, HashKindPoseidon, mt.HashKind())
+
+	// A MerkleTree without the hash function recorded uses Poseidon
+	stoLegacy := db.NewMemoryStorage()
+	tx, err := stoLegacy.WithPrefix(PREFIX_MERKLETREE).NewTx()
+	assert.Nil(t, err)
+	tx.Put(rootNodeValue, append([]byte{byte(DBEntryTypeRoot)}, HashZero[:]...))
+	assert.Nil(t, tx.Commit())
+	mtLegacy, err := NewMerkleTree(stoLegacy, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, HashKindPoseidon, mtLegacy.HashKind())
+	_, err = NewMerkleTreeHash(stoLegacy, 140, HashKindMimc7)
+	assert.Equal(t, ErrHashKindMismatch, err)
+}
+
+func TestHashKindMimc7Tree(t *testing.T) {
+	mtPoseidon := newTestingMerkle(t, 140)
+	defer mtPoseidon.Storage().Close()
+	mtMimc7, err := NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	defer mtMimc7.Storage().Close()
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		assert.Nil(t, mtPoseidon.Add(&e))
+		e = NewEntryFromInts(0, 0, 0, int64(i))
+		assert.Nil(t, mtMimc7.Add(&e))
+	}
+	assert.NotEqual(t, mtPoseidon.RootKey(), mtMimc7.RootKey())
+
+	e := NewEntryFromInts(0, 0, 0, 4)
+	hIndex := e.HIndexHasher(mtMimc7.Hasher())
+	hValue := e.HValueHasher(mtMimc7.Hasher())
+	data, err := mtMimc7.GetDataByIndex(hIndex)
+	assert.Nil(t, err)
+	assert.Equal(t, e.Data, *data)
+
+	proof, err := mtMimc7.GenerateProof(hIndex, nil)
+	assert.Nil(t, err)
+	assert.True(t, proof.Existence)
+	assert.Equal(t, HashKindMimc7, proof.HashKind)
+	assert.True(t, VerifyProof(mtMimc7.RootKey(), proof, hIndex, hValue))
+	assert.Equal(t, hIndex, mtMimc7.HIndex(&e))
+	assert.Equal(t, hValue, mtMimc7.HValue(&e))
+	assert.True(t, VerifyProofEntry(mtMimc7.RootKey(), proof, &e))
+	// The default hIndex of the entry is not the one of the tree
+	assert.NotEqual(t, hIndex, e.HIndex())
+	assert.True(t, !VerifyProof(mtMimc7.RootKey(), proof, e.HIndex(), e.HValue()))
+
+	// The hash kind is kept in the serialized proof
+	proofParsed, err := NewProofFromBytes(proof.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, proof, proofParsed)
+	assert.True(t, VerifyProof(mtMimc7.RootKey(), proofParsed, hIndex, hValue))
+
+	// The proof doesn't verify with a different hash function
+	proofParsed.HashKind = HashKindPoseidon
+	assert.True(t, !VerifyProof(mtMimc7.RootKey(), proofParsed, hIndex, hValue))
+
+	// Non-existence proof
+	e = NewEntryFromInts(0, 0, 0, 42)
+	hIndex = e.HIndexHasher(mtMimc7.Hasher())
+	hValue = e.HValueHasher(mtMimc7.Hasher())
+	proof, err = mtMimc7.GenerateProof(hIndex, nil)
+	assert.Nil(t, err)
+	assert.True(t, !proof.Existence)
+	assert.True(t, VerifyProof(mtMimc7.RootKey(), proof, hIndex, hValue))
+}
+
+func TestEntryHashKindCache(t *testing.T) {
+	e := NewEntryFromInts(12, 45, 78, 41)
+	hIndexPoseidon := *e.HIndex()
+	hIndexMimc7 := *e.HIndexHasher(HasherMimc7)
+	assert.NotEqual(t, hIndexPoseidon, hIndexMimc7)
+	assert.Equal(t, hIndexPoseidon, *e.HIndex())
+	assert.Equal(t, *HashElems(e.Data[2:]...), *e.HIndex())
+	assert.Equal(t, *HasherMimc7.HashElems(e.Data[:2]...), *e.HValueHasher(HasherMimc7))
+}
+
+func TestEntryHashConcurrent(t *testing.T) {
+	e := NewEntryFromInts(12, 45, 78, 41)
+	hIndexPoseidon := *HasherPoseidon.HashElems(e.Data[2:]...)
+	hIndexMimc7 := *HasherMimc7.HashElems(e.Data[2:]...)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(hasher Hasher, hIndex Hash) {
+			defer wg.Done()
+			assert.Equal(t, hIndex, *e.HIndexHasher(hasher))
+		}([]Hasher{HasherPoseidon, HasherMimc7}[i%2], []Hash{hIndexPoseidon, hIndexMimc7}[i%2])
+	}
+	wg.Wait()
+}
+
+func TestHashKindInvalidStored(t *testing.T) {
+	for _, value := range [][]byte{{9}, {byte(HashKindMimc7), 0}} {
+		sto := db.NewMemoryStorage()
+		tx, err := sto.WithPrefix(PREFIX_MERKLETREE).NewTx()
+		assert.Nil(t, err)
+		tx.Put(rootNodeValue, append([]byte{byte(DBEntryTypeRoot)}, HashZero[:]...))
+		tx.Put(hashKindValue, append([]byte{byte(DBEntryTypeHashKind)}, value...))
+		assert.Nil(t, tx.Commit())
+		_, err = NewMerkleTree(sto, 140)
+		assert.Equal(t, ErrInvalidHashKind, err)
+		_, err = Check(sto, nil)
+		assert.Equal(t, ErrInvalidHashKind, err)
+	}
+}
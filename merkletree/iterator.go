@@ -0,0 +1,143 @@
+package merkletree
+
+import (
+	"bytes"
+)
+
+// leafIteratorNode is a node pending to be visited by a LeafIterator.
+type leafIteratorNode struct {
+	key *Hash
+	lvl int
+}
+
+// LeafIterator iterates over the leafs of the tree with a root of a MT in the
+// order of their paths, where left goes before right, so that the iteration
+// can be stopped at any point and resumed later from the hIndex of the last
+// leaf (see LeafIteratorFrom).
+//
+//	it := mt.LeafIterator(nil)
+//	for it.Next() {
+//		e := it.Entry()
+//		[...]
+//	}
+//	if err := it.Err(); err != nil {
+//		[...]
+//	}
+type LeafIterator struct {
+	mt *MerkleTree
+	// stack contains the nodes pending to be visited, with the next one at
+	// the end.
+	stack []leafIteratorNode
+	leaf  *Node
+	err   error
+}
+
+// LeafIterator returns a LeafIterator over the leafs of the tree with the
+// given rootKey.  If rootKey is nil, the current root is used.
+func (mt *MerkleTree) LeafIterator(rootKey *Hash) *LeafIterator {
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	return &LeafIterator{mt: mt, stack: []leafIteratorNode{{key: rootKey, lvl: 0}}}
+}
+
+// pathLess returns true if the path of hIndexA goes before the path of
+// hIndexB in a LeafIterator.
+func pathLess(hIndexA, hIndexB *Hash) bool {
+	for i := uint(0); i < ElemBytesLen*8; i++ {
+		a, b := testBitBigEndian(hIndexA[:], i), testBitBigEndian(hIndexB[:], i)
+		if a != b {
+			return b
+		}
+	}
+	return false
+}
+
+// LeafIteratorFrom returns a LeafIterator over the leafs of the tree with the
+// given rootKey that go after the leaf with the hIndex cursor, which doesn't
+// need to be in the tree.  If rootKey is nil, the current root is used.
+func (mt *MerkleTree) LeafIteratorFrom(rootKey *Hash, cursor *Hash) (*LeafIterator, error) {
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	it := &LeafIterator{mt: mt}
+	path := getPath(mt.maxLevels, cursor)
+	key := rootKey
+	for lvl := 0; lvl < mt.maxLevels; lvl++ {
+		n, err := mt.GetNode(key)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Type {
+		case NodeTypeEmpty:
+			return it, nil
+		case NodeTypeLeaf:
+			if pathLess(cursor, n.Entry.HIndexHasher(mt.hasher)) {
+				it.stack = append(it.stack, leafIteratorNode{key: key, lvl: lvl})
+			}
+			return it, nil
+		case NodeTypeMiddle:
+			if path[lvl] {
+				key = n.ChildR
+			} else {
+				// The right subtree goes after the cursor
+				it.stack = append(it.stack, leafIteratorNode{key: n.ChildR, lvl: lvl + 1})
+				key = n.ChildL
+			}
+		default:
+			return nil, ErrInvalidNodeFound
+		}
+	}
+	return nil, ErrReachedMaxLevel
+}
+
+// Next advances the LeafIterator to the next leaf, returning false when there
+// are no more leafs or an error has been found.
+func (it *LeafIterator) Next() bool {
+	it.leaf = nil
+	for it.err == nil && len(it.stack) > 0 {
+		next := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if bytes.Equal(next.key[:], HashZero[:]) {
+			continue
+		}
+		n, err := it.mt.GetNode(next.key)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		switch n.Type {
+		case NodeTypeLeaf:
+			it.leaf = n
+			return true
+		case NodeTypeMiddle:
+			if next.lvl >= it.mt.maxLevels-1 {
+				it.err = ErrReachedMaxLevel
+				return false
+			}
+			it.stack = append(it.stack,
+				leafIteratorNode{key: n.ChildR, lvl: next.lvl + 1},
+				leafIteratorNode{key: n.ChildL, lvl: next.lvl + 1})
+		default:
+			it.err = ErrInvalidNodeFound
+			return false
+		}
+	}
+	return false
+}
+
+// Entry returns the Entry of the current leaf.
+func (it *LeafIterator) Entry() *Entry {
+	return it.leaf.Entry
+}
+
+// Cursor returns the hIndex of the current leaf, from which the iteration can
+// be resumed with LeafIteratorFrom.
+func (it *LeafIterator) Cursor() *Hash {
+	return it.leaf.Entry.HIndexHasher(it.mt.hasher)
+}
+
+// Err returns the error found during the iteration, if any.
+func (it *LeafIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,107 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// iterateLeafs returns the entries of up to limit leafs of the LeafIterator
+// (or all if limit is 0), with the cursor of the last one.
+func iterateLeafs(t *testing.T, it *LeafIterator, limit int) ([]*Entry, *Hash) {
+	var entries []*Entry
+	var cursor *Hash
+	for (limit == 0 || len(entries) < limit) && it.Next() {
+		entries = append(entries, it.Entry())
+		cursor = it.Cursor()
+	}
+	assert.Nil(t, it.Err())
+	return entries, cursor
+}
+
+// entriesBytes returns the bytes of the entries, which don't include the
+// cached hashes.
+func entriesBytes(entries []*Entry) [][]byte {
+	bs := make([][]byte, len(entries))
+	for i, e := range entries {
+		bs[i] = e.Bytes()
+	}
+	return bs
+}
+
+func TestLeafIterator(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	entries, _ := iterateLeafs(t, mt.LeafIterator(nil), 0)
+	assert.Equal(t, 0, len(entries))
+
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var walked []*Entry
+	err := mt.Walk(nil, func(n *Node) {
+		if n.Type == NodeTypeLeaf {
+			walked = append(walked, n.Entry)
+		}
+	})
+	assert.Nil(t, err)
+	entries, _ = iterateLeafs(t, mt.LeafIterator(nil), 0)
+	assert.Equal(t, entriesBytes(walked), entriesBytes(entries))
+	for i := 1; i < len(entries); i++ {
+		assert.True(t, pathLess(entries[i-1].HIndex(), entries[i].HIndex()))
+	}
+
+	// Pages
+	for _, limit := range []int{1, 7, 32, 64} {
+		paged, cursor := iterateLeafs(t, mt.LeafIterator(nil), limit)
+		for cursor != nil {
+			it, err := mt.LeafIteratorFrom(nil, cursor)
+			assert.Nil(t, err)
+			var page []*Entry
+			page, cursor = iterateLeafs(t, it, limit)
+			paged = append(paged, page...)
+		}
+		assert.Equal(t, entriesBytes(entries), entriesBytes(paged))
+	}
+}
+
+func TestLeafIteratorFrom(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := mt.RootKey()
+	entries, _ := iterateLeafs(t, mt.LeafIterator(nil), 0)
+
+	// A cursor of an entry that is not in the tree
+	for i := 32; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		var expected []*Entry
+		for _, e2 := range entries {
+			if pathLess(e.HIndex(), e2.HIndex()) {
+				expected = append(expected, e2)
+			}
+		}
+		it, err := mt.LeafIteratorFrom(nil, e.HIndex())
+		assert.Nil(t, err)
+		from, _ := iterateLeafs(t, it, 0)
+		assert.Equal(t, entriesBytes(expected), entriesBytes(from))
+	}
+
+	// The iteration of a past root is not affected by new entries
+	it, err := mt.LeafIteratorFrom(root, entries[9].HIndex())
+	assert.Nil(t, err)
+	e := NewEntryFromInts(0, 100, 0, 100)
+	assert.Nil(t, mt.Add(&e))
+	from, _ := iterateLeafs(t, it, 0)
+	assert.Equal(t, entriesBytes(entries[10:]), entriesBytes(from))
+}
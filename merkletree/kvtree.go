@@ -0,0 +1,279 @@
+package merkletree
+
+import (
+	"math/big"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// kvChunkLen is the number of bytes of each chunk in which hashBytes splits a
+// byte array, so that every chunk fits in the field.
+const kvChunkLen = ElemBytesLen - 1
+
+var (
+	// kvKeyPrefix is the prefix of the Keys used to store the keys of a
+	// KVTree in the database, followed by their hash.
+	kvKeyPrefix = []byte("kvkey")
+	// kvValuePrefix is the prefix of the Keys used to store the values of a
+	// KVTree in the database, followed by the hash of their key and their
+	// hash.
+	kvValuePrefix = []byte("kvvalue")
+)
+
+// kvKeyKey returns the Key in the database of the key with hash hKey.
+func kvKeyKey(hKey *Hash) []byte {
+	return append(append([]byte{}, kvKeyPrefix...), hKey[:]...)
+}
+
+// kvValueKey returns the Key in the database of the value with hash hValue
+// of the key with hash hKey.  The values are not shared between keys, so
+// that the value can be removed together with its key.
+func kvValueKey(hKey, hValue *Hash) []byte {
+	return append(append(append([]byte{}, kvValuePrefix...), hKey[:]...), hValue[:]...)
+}
+
+// hashBytes hashes a byte array of any length into a field element with the
+// hash function hasher.  The length of the array is hashed together with its
+// chunks, which are absorbed one by one.
+func hashBytes(hasher Hasher, b []byte) *Hash {
+	h := ElemBytes(BigIntToHash(big.NewInt(int64(len(b)))))
+	for i := 0; i == 0 || i < len(b); i += kvChunkLen {
+		var chunk ElemBytes
+		if i < len(b) {
+			end := i + kvChunkLen
+			if end > len(b) {
+				end = len(b)
+			}
+			copy(chunk[1:], b[i:end])
+		}
+		h = ElemBytes(*hasher.HashElems(h, chunk))
+	}
+	hash := Hash(h)
+	return &hash
+}
+
+// newKVEntry returns the Entry of a KVTree with the hashes of the key and the
+// value.
+func newKVEntry(hKey, hValue *Hash) *Entry {
+	var e Entry
+	e.Data[0] = ElemBytes(*hValue)
+	e.Data[2] = ElemBytes(*hKey)
+	return &e
+}
+
+// KVTree is a sparse merkle tree that maps keys to values of any length.
+// Each key and value is hashed to a field element with the hash function of
+// the MT, and the pair is stored as an Entry of a MerkleTree, so that the same
+// proofs can be used.  The keys and values themselves are stored in the same
+// storage under their hash, and they are removed when the key is deleted or
+// its value replaced, so the past roots of the KVTree can still be used for
+// proofs, but not to get the keys or values that are no longer in the current
+// root.
+type KVTree struct {
+	mt *MerkleTree
+}
+
+// NewKVTree generates a new KVTree, or opens the existing one in the storage,
+// with the default hash function.  The storage must not be shared with a
+// MerkleTree of claims.
+func NewKVTree(storage db.Storage, maxLevels int) (*KVTree, error) {
+	mt, err := NewMerkleTree(storage, maxLevels)
+	if err != nil {
+		return nil, err
+	}
+	return &KVTree{mt: mt}, nil
+}
+
+// NewKVTreeHash generates a new KVTree that uses the hash function of
+// hashKind, or opens the existing one in the storage (see
+// NewMerkleTreeHash).
+func NewKVTreeHash(storage db.Storage, maxLevels int, hashKind HashKind) (*KVTree, error) {
+	mt, err := NewMerkleTreeHash(storage, maxLevels, hashKind)
+	if err != nil {
+		return nil, err
+	}
+	return &KVTree{mt: mt}, nil
+}
+
+// MerkleTree returns the MerkleTree where the KVTree is stored.
+func (t *KVTree) MerkleTree() *MerkleTree {
+	return t.mt
+}
+
+// RootKey returns the root key of the KVTree.
+func (t *KVTree) RootKey() *Hash {
+	return t.mt.RootKey()
+}
+
+// Snapshot returns a read only KVTree with the given root.
+func (t *KVTree) Snapshot(rootKey *Hash) (*KVTree, error) {
+	mt, err := t.mt.Snapshot(rootKey)
+	if err != nil {
+		return nil, err
+	}
+	return &KVTree{mt: mt}, nil
+}
+
+// HIndex returns the hIndex of the Entry of key in the MT.
+func (t *KVTree) HIndex(key []byte) *Hash {
+	return newKVEntry(hashBytes(t.mt.hasher, key), &HashZero).HIndexHasher(t.mt.hasher)
+}
+
+// Put sets the value of the key, adding the key if it's not in the KVTree.
+// The key, the value and the Entry are stored in a single transaction, and
+// the previous value of the key is removed.
+func (t *KVTree) Put(key, value []byte) error {
+	// verify that the MerkleTree is writable
+	if !t.mt.writable {
+		return ErrNotWritable
+	}
+	mt := t.mt
+	hKey, hValue := hashBytes(mt.hasher, key), hashBytes(mt.hasher, value)
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	newNodeLeaf := newNodeLeafHasher(mt.hasher, newKVEntry(hKey, hValue))
+	hIndex := newNodeLeaf.Entry.HIndexHasher(mt.hasher)
+	path := getPath(mt.maxLevels, hIndex)
+
+	var newRootKey *Hash
+	oldLeaf, siblings, err := mt.pathSiblings(hIndex, path)
+	switch err {
+	case nil:
+		oldHValue := Hash(oldLeaf.Entry.Data[0])
+		if oldHValue == *hValue {
+			return nil
+		}
+		tx.Delete(kvValueKey(hKey, &oldHValue))
+		var leafKey *Hash
+		if leafKey, err = mt.addNode(tx, newNodeLeaf); err != nil {
+			return err
+		}
+		newRootKey, err = mt.recalculatePathUntilRoot(tx, path, leafKey, siblings)
+	case ErrEntryIndexNotFound:
+		tx.Put(kvKeyKey(hKey), key)
+		newRootKey, err = mt.addLeaf(tx, newNodeLeaf, mt.rootKey, 0, path)
+	}
+	if err != nil {
+		return err
+	}
+	tx.Put(kvValueKey(hKey, hValue), value)
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, []*Hash{hIndex}); err != nil {
+		return err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return err
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return nil
+}
+
+// Get returns the value of the key.  If the key is not in the KVTree,
+// ErrEntryIndexNotFound is returned.
+func (t *KVTree) Get(key []byte) ([]byte, error) {
+	hKey := hashBytes(t.mt.hasher, key)
+	data, err := t.mt.GetDataByIndex(newKVEntry(hKey, &HashZero).HIndexHasher(t.mt.hasher))
+	if err != nil {
+		return nil, err
+	}
+	hValue := Hash(data[0])
+	return t.mt.storage.Get(kvValueKey(hKey, &hValue))
+}
+
+// Delete removes the key from the KVTree, together with its value.
+func (t *KVTree) Delete(key []byte) error {
+	// verify that the MerkleTree is writable
+	if !t.mt.writable {
+		return ErrNotWritable
+	}
+	mt := t.mt
+	hKey := hashBytes(mt.hasher, key)
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	hIndex := newKVEntry(hKey, &HashZero).HIndexHasher(mt.hasher)
+	path := getPath(mt.maxLevels, hIndex)
+
+	oldLeaf, siblings, err := mt.pathSiblings(hIndex, path)
+	if err != nil {
+		return err
+	}
+	newRootKey, err := mt.rmAndUpload(tx, path, siblings)
+	if err != nil {
+		return err
+	}
+	oldHValue := Hash(oldLeaf.Entry.Data[0])
+	tx.Delete(kvKeyKey(hKey))
+	tx.Delete(kvValueKey(hKey, &oldHValue))
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, []*Hash{hIndex}); err != nil {
+		return err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return err
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return nil
+}
+
+// Walk calls f with each key and value of the KVTree with the given rootKey.
+// If rootKey is nil, the current root is used.  Walking a past root fails with
+// db.ErrNotFound if any of its keys has been deleted or updated since.
+func (t *KVTree) Walk(rootKey *Hash, f func(key, value []byte) error) error {
+	if rootKey == nil {
+		rootKey = t.mt.RootKey()
+	}
+	return t.mt.walkLeaves(rootKey, func(n *Node) error {
+		hKey, hValue := Hash(n.Entry.Data[2]), Hash(n.Entry.Data[0])
+		key, err := t.mt.storage.Get(kvKeyKey(&hKey))
+		if err != nil {
+			return err
+		}
+		value, err := t.mt.storage.Get(kvValueKey(&hKey, &hValue))
+		if err != nil {
+			return err
+		}
+		return f(key, value)
+	})
+}
+
+// GenerateProof generates the proof of existence (or non-existence) of the
+// key in the KVTree with the given root.  If the rootKey is nil, the current
+// root is used.
+func (t *KVTree) GenerateProof(key []byte, rootKey *Hash) (*Proof, error) {
+	return t.mt.GenerateProof(t.HIndex(key), rootKey)
+}
+
+// VerifyKVProof verifies the proof of the key and value for the root of a
+// KVTree.  For a proof of non-existence the value is not used.
+func VerifyKVProof(rootKey *Hash, proof *Proof, key, value []byte) bool {
+	hasher, err := proof.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
+	e := newKVEntry(hashBytes(hasher, key), hashBytes(hasher, value))
+	return VerifyProof(rootKey, proof, e.HIndexHasher(hasher), e.HValueHasher(hasher))
+}
@@ -0,0 +1,122 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashBytes(t *testing.T) {
+	inputs := [][]byte{nil, {0}, {0, 0}, []byte("a"), []byte("a\x00"),
+		bytes.Repeat([]byte{1}, kvChunkLen), bytes.Repeat([]byte{1}, kvChunkLen+1)}
+	hashes := make(map[Hash]struct{})
+	for _, b := range inputs {
+		h := hashBytes(HasherPoseidon, b)
+		assert.Equal(t, h, hashBytes(HasherPoseidon, b))
+		hashes[*h] = struct{}{}
+	}
+	assert.Equal(t, len(inputs), len(hashes))
+}
+
+func TestKVTree(t *testing.T) {
+	kv, err := NewKVTree(db.NewMemoryStorage(), 140)
+	assert.Nil(t, err)
+	defer kv.MerkleTree().Storage().Close()
+
+	values := make(map[string]string)
+	for i := 0; i < 32; i++ {
+		key := fmt.Sprintf("key%v", i)
+		value := fmt.Sprintf("value%v", i)
+		assert.Nil(t, kv.Put([]byte(key), []byte(value)))
+		values[key] = value
+	}
+	// Long keys and values, and empty ones
+	longKey := bytes.Repeat([]byte("k"), 1000)
+	assert.Nil(t, kv.Put(longKey, bytes.Repeat([]byte("v"), 5000)))
+	values[string(longKey)] = string(bytes.Repeat([]byte("v"), 5000))
+	assert.Nil(t, kv.Put([]byte{}, []byte{}))
+	values[""] = ""
+
+	for key, value := range values {
+		v, err := kv.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(v))
+	}
+	_, err = kv.Get([]byte("missing"))
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+
+	// Update and delete
+	root := kv.RootKey()
+	assert.Nil(t, kv.Put([]byte("key3"), []byte("new value")))
+	v, err := kv.Get([]byte("key3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new value", string(v))
+	assert.Nil(t, kv.Delete([]byte("key4")))
+	_, err = kv.Get([]byte("key4"))
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+	assert.Equal(t, ErrEntryIndexNotFound, kv.Delete([]byte("key4")))
+
+	// The previous root can still be used for proofs, but the replaced and
+	// deleted values are removed
+	snapshot, err := kv.Snapshot(root)
+	assert.Nil(t, err)
+	_, err = snapshot.Get([]byte("key3"))
+	assert.Equal(t, db.ErrNotFound, err)
+	_, err = snapshot.Get([]byte("key4"))
+	assert.Equal(t, db.ErrNotFound, err)
+	v, err = snapshot.Get([]byte("key5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value5", string(v))
+	proof, err := snapshot.GenerateProof([]byte("key4"), nil)
+	assert.Nil(t, err)
+	assert.True(t, VerifyKVProof(root, proof, []byte("key4"), []byte("value4")))
+	assert.Equal(t, ErrNotWritable, snapshot.Put([]byte("key5"), []byte("value")))
+	assert.Equal(t, db.ErrNotFound, snapshot.Walk(nil, func(key, value []byte) error { return nil }))
+
+	values["key3"] = "new value"
+	delete(values, "key4")
+	walked := make(map[string]string)
+	assert.Nil(t, kv.Walk(nil, func(key, value []byte) error {
+		walked[string(key)] = string(value)
+		return nil
+	}))
+	assert.Equal(t, values, walked)
+
+	// Putting the same value doesn't change the root, and only the blobs of
+	// the current keys are left in the storage
+	root = kv.RootKey()
+	assert.Nil(t, kv.Put([]byte("key5"), []byte("value5")))
+	assert.Equal(t, root, kv.RootKey())
+	blobs := 0
+	assert.Nil(t, kv.MerkleTree().Storage().Iterate(func(k, v []byte) (bool, error) {
+		if bytes.HasPrefix(k, kvKeyPrefix) || bytes.HasPrefix(k, kvValuePrefix) {
+			blobs++
+		}
+		return true, nil
+	}))
+	assert.Equal(t, 2*len(values), blobs)
+}
+
+func TestKVTreeProof(t *testing.T) {
+	kv, err := NewKVTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	defer kv.MerkleTree().Storage().Close()
+	for i := 0; i < 16; i++ {
+		assert.Nil(t, kv.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i))))
+	}
+
+	proof, err := kv.GenerateProof([]byte("key7"), nil)
+	assert.Nil(t, err)
+	assert.True(t, proof.Existence)
+	assert.True(t, VerifyKVProof(kv.RootKey(), proof, []byte("key7"), []byte("value7")))
+	assert.False(t, VerifyKVProof(kv.RootKey(), proof, []byte("key7"), []byte("value8")))
+	assert.False(t, VerifyKVProof(kv.RootKey(), proof, []byte("key8"), []byte("value7")))
+
+	proof, err = kv.GenerateProof([]byte("key16"), nil)
+	assert.Nil(t, err)
+	assert.False(t, proof.Existence)
+	assert.True(t, VerifyKVProof(kv.RootKey(), proof, []byte("key16"), nil))
+}
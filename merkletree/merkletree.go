@@ -9,6 +9,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	common3 "github.com/iden3/go-iden3-core/common"
 	"github.com/iden3/go-iden3-core/db"
@@ -94,7 +95,12 @@ const (
 )
 
 var (
-	// ErrNodeKeyAlreadyExists is used when a node key already exists.
+	// ErrNodeKeyAlreadyExists was used when a node key already exists.
+	//
+	// Deprecated: adding a node that already exists is not an error since
+	// nodes are content-addressed and shared between roots (which is
+	// needed to delete entries and to keep several roots), so this error is
+	// no longer returned.
 	ErrNodeKeyAlreadyExists = errors.New("node already exists")
 	// ErrEntryIndexNotFound is used when no entry is found for an index.
 	ErrEntryIndexNotFound = errors.New("node index not found in the DB")
@@ -118,12 +124,17 @@ var (
 	ErrEntryIndexAlreadyExists = errors.New("the entry index already exists in the tree")
 	// ErrNotWritable is used when the MerkleTree is not writable and a write function is called
 	ErrNotWritable = errors.New("Merkle Tree not writable")
+	// ErrInvalidMaxLevels is used when the maximum number of levels of a
+	// MT is less than 1.
+	ErrInvalidMaxLevels = errors.New("the maximum number of levels of the merkle tree must be at least 1")
 	// HashZero is a hash value of zeros, and is the key of an empty node.
 	HashZero = Hash{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	// ElemBytesOne is a constant element used as a prefix to compute leaf node keys.
 	ElemBytesOne = ElemBytes{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
 	// rootNodeVValue is the Key used to store the current Root in the database
 	rootNodeValue = []byte("currentroot")
+	// hashKindValue is the Key used to store the kind of hash function of the MT in the database
+	hashKindValue = []byte("hashkind")
 )
 
 // Entry is the generic type that is stored in the MT.  The entry should not be
@@ -131,10 +142,17 @@ var (
 // updated.
 type Entry struct {
 	Data Data
-	// hIndex is a cache used to avoid recalculating hIndex
-	hIndex *Hash
-	// hValue is a cache used to avoid recalculating hValue
-	hValue *Hash
+	// hashes caches the hIndex and hValue calculated with each kind of hash
+	// function, to avoid recalculating them.  The caches are written
+	// atomically, so the same Entry can be hashed concurrently.
+	hashes [hashKindsLen]entryHashes
+}
+
+// entryHashes is the cache of the hIndex and hValue of an Entry calculated
+// with a kind of hash function.
+type entryHashes struct {
+	hIndex atomic.Value
+	hValue atomic.Value
 }
 
 type Claim interface {
@@ -151,20 +169,53 @@ func NewEntryFromBytes(b []byte) (*Entry, error) {
 }
 
 // HIndex calculates the hash of the Index of the entry, used to find the path
-// from the root to the leaf in the MT.
+// from the root to the leaf in the MT, with the default hash function.  For a
+// MT that may use another hash function, use MerkleTree.HIndex.
 func (e *Entry) HIndex() *Hash {
-	if e.hIndex == nil { // Cache the hIndex.
-		//e.hIndex = HashElems(e.Index()[:]...)
-		e.hIndex = HashElems(e.Data[2:]...)
-	}
-	return e.hIndex
+	return e.HIndexHasher(HasherPoseidon)
 }
 
+// HValue calculates the hash of the Value of the entry with the default hash
+// function.  For a MT that may use another hash function, use
+// MerkleTree.HValue.
 func (e *Entry) HValue() *Hash {
-	if e.hValue == nil { // Cache the hValue.
-		e.hValue = HashElems(e.Data[:2]...)
+	return e.HValueHasher(HasherPoseidon)
+}
+
+// hashesCache returns the cache of the hashes of the entry calculated with the
+// hash function hasher.
+func (e *Entry) hashesCache(hasher Hasher) *entryHashes {
+	if kind := int(hasher.Kind()); kind < len(e.hashes) {
+		return &e.hashes[kind]
+	}
+	// The hashes of an unknown kind of hash function are not cached.
+	return &entryHashes{}
+}
+
+// HIndexHasher calculates the hash of the Index of the entry with the hash
+// function hasher.  It must be used instead of HIndex for a MT that doesn't use
+// the default hash function.
+func (e *Entry) HIndexHasher(hasher Hasher) *Hash {
+	c := e.hashesCache(hasher)
+	if hIndex, ok := c.hIndex.Load().(*Hash); ok {
+		return hIndex
+	}
+	//hIndex := HashElems(e.Index()[:]...)
+	hIndex := hasher.HashElems(e.Data[2:]...)
+	c.hIndex.Store(hIndex)
+	return hIndex
+}
+
+// HValueHasher calculates the hash of the Value of the entry with the hash
+// function hasher.
+func (e *Entry) HValueHasher(hasher Hasher) *Hash {
+	c := e.hashesCache(hasher)
+	if hValue, ok := c.hValue.Load().(*Hash); ok {
+		return hValue
 	}
-	return e.hValue
+	hValue := hasher.HashElems(e.Data[:2]...)
+	c.hValue.Store(hValue)
+	return hValue
 }
 
 func (e *Entry) Bytes() []byte {
@@ -195,16 +246,57 @@ type MerkleTree struct {
 	maxLevels int
 	// writable indicates if the Merkle Tree allows to write or only to read
 	writable bool
+	// hasher is the hash function used in the Merkle Tree
+	hasher Hasher
+	// cache is the optional cache of nodes read from the storage
+	cache *nodeCache
 }
 
 var PREFIX_MERKLETREE = []byte("merkletree")
 
-// NewMerkleTree generates a new Merkle Tree
+// NewMerkleTree generates a new Merkle Tree.  If the Merkle Tree already exists
+// in the storage, it uses the hash function recorded in the storage, otherwise
+// it uses the default hash function (Poseidon).
 func NewMerkleTree(storage db.Storage, maxLevels int) (*MerkleTree, error) {
+	return newMerkleTree(storage, maxLevels, nil)
+}
+
+// NewMerkleTreeHash generates a new Merkle Tree that uses the hash function of
+// hashKind, which is recorded in the storage.  If the Merkle Tree already exists
+// in the storage with a different hash function, ErrHashKindMismatch is
+// returned.
+func NewMerkleTreeHash(storage db.Storage, maxLevels int, hashKind HashKind) (*MerkleTree, error) {
+	return newMerkleTree(storage, maxLevels, &hashKind)
+}
+
+// OpenMerkleTree opens the Merkle Tree that already exists in the storage as
+// read only, without writing to the storage.  If there is no Merkle Tree in the
+// storage, db.ErrNotFound is returned.
+func OpenMerkleTree(storage db.Storage, maxLevels int) (*MerkleTree, error) {
+	mt := MerkleTree{storage: storage.WithPrefix(PREFIX_MERKLETREE)}
+	if _, _, err := mt.dbGet(rootNodeValue); err != nil {
+		return nil, err
+	}
+	openMt, err := newMerkleTree(storage, maxLevels, nil)
+	if err != nil {
+		return nil, err
+	}
+	openMt.writable = false
+	return openMt, nil
+}
+
+func newMerkleTree(storage db.Storage, maxLevels int, hashKind *HashKind) (*MerkleTree, error) {
 	mtSto := storage.WithPrefix(PREFIX_MERKLETREE)
 	mt := MerkleTree{storage: mtSto, maxLevels: maxLevels, writable: true}
 	_, gettedRoot, err := mt.dbGet(rootNodeValue)
 	if err != nil {
+		kind := HashKindPoseidon
+		if hashKind != nil {
+			kind = *hashKind
+		}
+		if mt.hasher, err = kind.Hasher(); err != nil {
+			return nil, err
+		}
 		tx, err := mt.storage.NewTx()
 		if err != nil {
 			return nil, err
@@ -213,6 +305,12 @@ func NewMerkleTree(storage db.Storage, maxLevels int) (*MerkleTree, error) {
 		k, _ := nodeRoot.Key(), nodeRoot.Value()
 		mt.rootKey = k
 		mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+		mt.dbInsert(tx, hashKindValue, DBEntryTypeHashKind, []byte{byte(kind)})
+		mt.dbInsert(tx, statsValue, DBEntryTypeStats, newTreeStats().bytes(mt.rootKey))
+		if err = mt.logRoot(tx, mt.rootKey); err != nil {
+			tx.Close()
+			return nil, err
+		}
 		if err = tx.Commit(); err != nil {
 			tx.Close()
 			return nil, err
@@ -221,6 +319,17 @@ func NewMerkleTree(storage db.Storage, maxLevels int) (*MerkleTree, error) {
 	}
 	mt.rootKey = &Hash{}
 	copy(mt.rootKey[:], gettedRoot)
+
+	kind, err := mt.dbGetHashKind()
+	if err != nil {
+		return nil, err
+	}
+	if hashKind != nil && *hashKind != kind {
+		return nil, ErrHashKindMismatch
+	}
+	if mt.hasher, err = kind.Hasher(); err != nil {
+		return nil, err
+	}
 	return &mt, nil
 }
 
@@ -231,7 +340,8 @@ func (mt *MerkleTree) Snapshot(rootKey *Hash) (*MerkleTree, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MerkleTree{storage: mt.storage, maxLevels: mt.maxLevels, rootKey: rootKey, writable: false}, nil
+	return &MerkleTree{storage: mt.storage, maxLevels: mt.maxLevels, rootKey: rootKey, writable: false,
+		hasher: mt.hasher, cache: mt.cache}, nil
 }
 
 // Storage returns the MT storage
@@ -251,6 +361,29 @@ func (mt *MerkleTree) MaxLevels() int {
 	return mt.maxLevels
 }
 
+// Hasher returns the hash function used in the MT.  The hIndex of the entries
+// of the MT must be calculated with it (see Entry.HIndexHasher).
+func (mt *MerkleTree) Hasher() Hasher {
+	return mt.hasher
+}
+
+// HashKind returns the kind of hash function used in the MT.
+func (mt *MerkleTree) HashKind() HashKind {
+	return mt.hasher.Kind()
+}
+
+// HIndex calculates the hash of the Index of the entry with the hash function
+// of the MT, which is the hIndex expected by GetDataByIndex and GenerateProof.
+func (mt *MerkleTree) HIndex(e *Entry) *Hash {
+	return e.HIndexHasher(mt.hasher)
+}
+
+// HValue calculates the hash of the Value of the entry with the hash function
+// of the MT.
+func (mt *MerkleTree) HValue(e *Entry) *Hash {
+	return e.HValueHasher(mt.hasher)
+}
+
 // GetDataByIndex returns the data from the MT in the position of the hash of
 // the index (hIndex)
 func (mt *MerkleTree) GetDataByIndex(hIndex *Hash) (*Data, error) {
@@ -265,7 +398,7 @@ func (mt *MerkleTree) GetDataByIndex(hIndex *Hash) (*Data, error) {
 		case NodeTypeEmpty:
 			return nil, ErrEntryIndexNotFound
 		case NodeTypeLeaf:
-			if bytes.Equal(hIndex[:], n.Entry.HIndex()[:]) {
+			if bytes.Equal(hIndex[:], n.Entry.HIndexHasher(mt.hasher)[:]) {
 				return &n.Entry.Data, nil
 			} else {
 				return nil, ErrEntryIndexNotFound
@@ -298,16 +431,16 @@ func (mt *MerkleTree) pushLeaf(tx db.Tx, newLeaf *Node, oldLeaf *Node,
 			return nil, err
 		}
 		if pathNewLeaf[lvl] {
-			newNodeMiddle = NewNodeMiddle(&HashZero, nextKey) // go right
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, &HashZero, nextKey) // go right
 		} else {
-			newNodeMiddle = NewNodeMiddle(nextKey, &HashZero) // go left
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, nextKey, &HashZero) // go left
 		}
 		return mt.addNode(tx, newNodeMiddle)
 	} else {
 		if pathNewLeaf[lvl] {
-			newNodeMiddle = NewNodeMiddle(oldLeaf.Key(), newLeaf.Key())
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, oldLeaf.Key(), newLeaf.Key())
 		} else {
-			newNodeMiddle = NewNodeMiddle(newLeaf.Key(), oldLeaf.Key())
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, newLeaf.Key(), oldLeaf.Key())
 		}
 		// We can add newLeaf now.  We don't need to add oldLeaf because it's already in the tree.
 		_, err := mt.addNode(tx, newLeaf)
@@ -335,10 +468,10 @@ func (mt *MerkleTree) addLeaf(tx db.Tx, newLeaf *Node, key *Hash,
 		// We can add newLeaf now
 		return mt.addNode(tx, newLeaf)
 	case NodeTypeLeaf:
-		// TODO: delete old node n???  Make this optional???
-		hIndex := n.Entry.HIndex()
+		// The old node n is kept so that past roots remain valid; see Prune
+		hIndex := n.Entry.HIndexHasher(mt.hasher)
 		// Check if leaf node found contains the leaf node we are trying to add
-		if bytes.Equal(hIndex[:], newLeaf.Entry.HIndex()[:]) {
+		if bytes.Equal(hIndex[:], newLeaf.Entry.HIndexHasher(mt.hasher)[:]) {
 			return nil, ErrEntryIndexAlreadyExists
 		}
 		pathOldLeaf := getPath(mt.maxLevels, hIndex)
@@ -349,15 +482,15 @@ func (mt *MerkleTree) addLeaf(tx db.Tx, newLeaf *Node, key *Hash,
 		var newNodeMiddle *Node
 		if path[lvl] {
 			nextKey, err = mt.addLeaf(tx, newLeaf, n.ChildR, lvl+1, path) // go right
-			newNodeMiddle = NewNodeMiddle(n.ChildL, nextKey)
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, n.ChildL, nextKey)
 		} else {
 			nextKey, err = mt.addLeaf(tx, newLeaf, n.ChildL, lvl+1, path) // go left
-			newNodeMiddle = NewNodeMiddle(nextKey, n.ChildR)
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, nextKey, n.ChildR)
 		}
 		if err != nil {
 			return nil, err
 		}
-		// TODO: delete old node n???  Make this optional???
+		// The old node n is kept so that past roots remain valid; see Prune
 		// Update the node to reflect the modified child
 		return mt.addNode(tx, newNodeMiddle)
 	default:
@@ -365,21 +498,36 @@ func (mt *MerkleTree) addLeaf(tx db.Tx, newLeaf *Node, key *Hash,
 	}
 }
 
+// checkEntryInField verifies that the ElemBytes of the Entry are valid and fit
+// inside the mimc7 field.
+func checkEntryInField(e *Entry) error {
+	bigints := ElemBytesToBigInts(e.Data[:]...)
+	ok := cryptoUtils.CheckBigIntArrayInField(bigints, cryptoConstants.Q)
+	if !ok {
+		return errors.New("Elements not inside the Finite Field over R")
+	}
+	return nil
+}
+
 // Add adds the Entry to the MerkleTree
 func (mt *MerkleTree) Add(e *Entry) error {
+	_, err := mt.add(e, false)
+	return err
+}
+
+// add adds the Entry to the MerkleTree, returning the TransitionWitness of
+// the insertion if witness is true.
+func (mt *MerkleTree) add(e *Entry, witness bool) (*TransitionWitness, error) {
 	// verify that the MerkleTree is writable
 	if !mt.writable {
-		return ErrNotWritable
+		return nil, ErrNotWritable
 	}
-	// verfy that the ElemBytes are valid and fit inside the mimc7 field.
-	bigints := ElemBytesToBigInts(e.Data[:]...)
-	ok := cryptoUtils.CheckBigIntArrayInField(bigints, cryptoConstants.Q)
-	if !ok {
-		return errors.New("Elements not inside the Finite Field over R")
+	if err := checkEntryInField(e); err != nil {
+		return nil, err
 	}
 	tx, err := mt.storage.NewTx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	mt.Lock()
 	defer func() {
@@ -391,19 +539,225 @@ func (mt *MerkleTree) Add(e *Entry) error {
 		mt.Unlock()
 	}()
 
-	newNodeLeaf := NewNodeLeaf(e)
-	hIndex := e.HIndex()
+	newNodeLeaf := newNodeLeafHasher(mt.hasher, e)
+	hIndex := e.HIndexHasher(mt.hasher)
 	path := getPath(mt.maxLevels, hIndex)
 
+	var proof *Proof
+	if witness {
+		if proof, err = mt.GenerateProof(hIndex, mt.rootKey); err != nil {
+			return nil, err
+		}
+	}
 	newRootKey, err := mt.addLeaf(tx, newNodeLeaf, mt.rootKey, 0, path)
+	if err != nil {
+		return nil, err
+	}
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, []*Hash{hIndex}); err != nil {
+		return nil, err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return nil, err
+	}
+	var w *TransitionWitness
+	if witness {
+		w = mt.newTransitionWitness(proof, mt.rootKey, newRootKey, hIndex, e.HValueHasher(mt.hasher))
+	}
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return w, nil
+}
+
+// pathSiblings follows the path of hIndex from the root until it finds the
+// leaf of the entry with hIndex, and returns the leaf together with the
+// siblings found along the path.
+func (mt *MerkleTree) pathSiblings(hIndex *Hash, path []bool) (*Node, []*Hash, error) {
+	var siblings []*Hash
+	nextKey := mt.rootKey
+	for lvl := 0; lvl < mt.maxLevels; lvl++ {
+		n, err := mt.GetNode(nextKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch n.Type {
+		case NodeTypeEmpty:
+			return nil, nil, ErrEntryIndexNotFound
+		case NodeTypeLeaf:
+			if !bytes.Equal(hIndex[:], n.Entry.HIndexHasher(mt.hasher)[:]) {
+				return nil, nil, ErrEntryIndexNotFound
+			}
+			return n, siblings, nil
+		case NodeTypeMiddle:
+			if path[lvl] {
+				nextKey = n.ChildR
+				siblings = append(siblings, n.ChildL)
+			} else {
+				nextKey = n.ChildL
+				siblings = append(siblings, n.ChildR)
+			}
+		default:
+			return nil, nil, ErrInvalidNodeFound
+		}
+	}
+	return nil, nil, ErrEntryIndexNotFound
+}
+
+// recalculatePathUntilRoot adds the middle nodes of the path from the node
+// with the given key up to the root, using the siblings found along the path,
+// and returns the new root key.
+func (mt *MerkleTree) recalculatePathUntilRoot(tx db.Tx, path []bool, key *Hash,
+	siblings []*Hash) (*Hash, error) {
+	var err error
+	for lvl := len(siblings) - 1; lvl >= 0; lvl-- {
+		var newNodeMiddle *Node
+		if path[lvl] {
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, siblings[lvl], key)
+		} else {
+			newNodeMiddle = newNodeMiddleHasher(mt.hasher, key, siblings[lvl])
+		}
+		if key, err = mt.addNode(tx, newNodeMiddle); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// rmAndUpload rebuilds the path from the position of a removed leaf up to the
+// root, given the siblings found along the path.  While a middle node is left
+// with a leaf as the only non-empty child, the leaf is moved up replacing it,
+// so that the resulting tree is the same as if the removed leaf had never been
+// added.
+func (mt *MerkleTree) rmAndUpload(tx db.Tx, path []bool, siblings []*Hash) (*Hash, error) {
+	key := &HashZero
+	for lvl := len(siblings) - 1; lvl >= 0; lvl-- {
+		sibling := siblings[lvl]
+		if bytes.Equal(sibling[:], HashZero[:]) {
+			// key is empty or a leaf, so it goes up
+			continue
+		}
+		if bytes.Equal(key[:], HashZero[:]) {
+			n, err := mt.GetNode(sibling)
+			if err != nil {
+				return nil, err
+			}
+			if n.Type == NodeTypeLeaf {
+				// The sibling leaf goes up
+				key = sibling
+				continue
+			}
+		}
+		return mt.recalculatePathUntilRoot(tx, path, key, siblings[:lvl+1])
+	}
+	return key, nil
+}
+
+// deleteLeaf removes the leaf of the entry with hIndex, returning the new root
+// key.
+func (mt *MerkleTree) deleteLeaf(tx db.Tx, hIndex *Hash, path []bool) (*Hash, error) {
+	_, siblings, err := mt.pathSiblings(hIndex, path)
+	if err != nil {
+		return nil, err
+	}
+	return mt.rmAndUpload(tx, path, siblings)
+}
+
+// Delete removes the Entry with the given hIndex from the MerkleTree.  The
+// resulting root is the same as the one of a MerkleTree where the Entry was
+// never added.
+func (mt *MerkleTree) Delete(hIndex *Hash) error {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	tx, err := mt.storage.NewTx()
 	if err != nil {
 		return err
 	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	path := getPath(mt.maxLevels, hIndex)
+
+	newRootKey, err := mt.deleteLeaf(tx, hIndex, path)
+	if err != nil {
+		return err
+	}
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, []*Hash{hIndex}); err != nil {
+		return err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return err
+	}
 	mt.rootKey = newRootKey
 	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
 	return nil
 }
 
+// updateLeaf replaces the leaf of the entry with the same hIndex as newLeaf,
+// returning the new root key.
+func (mt *MerkleTree) updateLeaf(tx db.Tx, newLeaf *Node, path []bool) (*Hash, error) {
+	_, siblings, err := mt.pathSiblings(newLeaf.Entry.HIndexHasher(mt.hasher), path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := mt.addNode(tx, newLeaf)
+	if err != nil {
+		return nil, err
+	}
+	return mt.recalculatePathUntilRoot(tx, path, key, siblings)
+}
+
+// Update replaces the value of the Entry in the MerkleTree that has the same
+// hIndex as e, and returns the roots before and after the update.
+func (mt *MerkleTree) Update(e *Entry) (*Hash, *Hash, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return nil, nil, ErrNotWritable
+	}
+	if err := checkEntryInField(e); err != nil {
+		return nil, nil, err
+	}
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return nil, nil, err
+	}
+	mt.Lock()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Close()
+		}
+		mt.Unlock()
+	}()
+
+	newNodeLeaf := newNodeLeafHasher(mt.hasher, e)
+	hIndex := e.HIndexHasher(mt.hasher)
+	path := getPath(mt.maxLevels, hIndex)
+
+	newRootKey, err := mt.updateLeaf(tx, newNodeLeaf, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = mt.updateStats(tx, mt.rootKey, newRootKey, []*Hash{hIndex}); err != nil {
+		return nil, nil, err
+	}
+	if err = mt.logRoot(tx, newRootKey); err != nil {
+		return nil, nil, err
+	}
+	oldRootKey := mt.rootKey
+	mt.rootKey = newRootKey
+	mt.dbInsert(tx, rootNodeValue, DBEntryTypeRoot, mt.rootKey[:])
+	return oldRootKey, newRootKey, nil
+}
+
 // walk is a helper recursive function to iterate over all tree branches
 func (mt *MerkleTree) walk(key *Hash, f func(*Node)) error {
 	n, err := mt.GetNode(key)
@@ -479,9 +833,11 @@ func (mt *MerkleTree) DumpClaims(rootKey *Hash) ([]string, error) {
 }
 
 // ImportClaims parses and adds the dumped list of claims in hex from the
-// DumpClaims function.
+// DumpClaims function.  The claims are added with AddBulk, so if any of them
+// can't be added, none of them are.
 func (mt *MerkleTree) ImportDumpedClaims(dumpedClaims []string) error {
-	for _, c := range dumpedClaims {
+	entries := make([]*Entry, len(dumpedClaims))
+	for i, c := range dumpedClaims {
 		if strings.HasPrefix(c, "0x") {
 			c = c[2:]
 		}
@@ -494,13 +850,9 @@ func (mt *MerkleTree) ImportDumpedClaims(dumpedClaims []string) error {
 		if err != nil {
 			return err
 		}
-
-		err = mt.Add(&e)
-		if err != nil {
-			return err
-		}
+		entries[i] = &e
 	}
-	return nil
+	return mt.AddBulk(entries, 0)
 }
 
 // DumpClaimsIoWriter uses Walk function to get all the Claims of the tree and write
@@ -538,6 +890,8 @@ type Proof struct {
 	// Siblings is a list of non-empty sibling keys.
 	Siblings []*Hash
 	nodeAux  *nodeAux
+	// HashKind is the kind of hash function of the MT of the proof.
+	HashKind HashKind
 }
 
 // NewProofFromBytes parses a byte array into a Proof.
@@ -549,6 +903,10 @@ func NewProofFromBytes(bs []byte) (*Proof, error) {
 	if (bs[0] & 0x01) == 0 {
 		p.Existence = true
 	}
+	p.HashKind = HashKind((bs[0] >> 2) & 0x03)
+	if _, err := p.HashKind.Hasher(); err != nil {
+		return nil, ErrInvalidProofBytes
+	}
 	p.depth = uint(bs[1])
 	copy(p.notempties[:], bs[proofFlagsLen:ElemBytesLen])
 	siblingBytes := bs[ElemBytesLen:]
@@ -588,6 +946,7 @@ func (p *Proof) Bytes() []byte {
 	if !p.Existence {
 		bs[0] |= 0x01
 	}
+	bs[0] |= byte(p.HashKind) << 2
 	bs[1] = byte(p.depth)
 	copy(bs[proofFlagsLen:len(p.notempties)+proofFlagsLen], p.notempties[:])
 	siblingsBytes := bs[len(p.notempties)+proofFlagsLen:]
@@ -623,6 +982,7 @@ func (p *Proof) UnmarshalJSON(bs []byte) error {
 func (p *Proof) String() string {
 	buf := bytes.NewBufferString("Proof:\n")
 	fmt.Fprintf(buf, "\texistence: %v\n", p.Existence)
+	fmt.Fprintf(buf, "\thash: %v\n", p.HashKind)
 	fmt.Fprintf(buf, "\tdepth: %v\n", p.depth)
 	fmt.Fprintf(buf, "\tnotempties: ")
 	for i := uint(0); i < p.depth; i++ {
@@ -654,7 +1014,7 @@ func (p *Proof) String() string {
 // Entry's hash Index for a Merkle Tree given the root.
 // If the rootKey is nil, the current merkletree root is used
 func (mt *MerkleTree) GenerateProof(hIndex *Hash, rootKey *Hash) (*Proof, error) {
-	p := &Proof{}
+	p := &Proof{HashKind: mt.hasher.Kind()}
 	var siblingKey *Hash
 
 	path := getPath(mt.maxLevels, hIndex)
@@ -671,12 +1031,12 @@ func (mt *MerkleTree) GenerateProof(hIndex *Hash, rootKey *Hash) (*Proof, error)
 		case NodeTypeEmpty:
 			return p, nil
 		case NodeTypeLeaf:
-			if bytes.Equal(hIndex[:], n.Entry.HIndex()[:]) {
+			if bytes.Equal(hIndex[:], n.Entry.HIndexHasher(mt.hasher)[:]) {
 				p.Existence = true
 				return p, nil
 			} else {
 				// We found a leaf whose entry didn't match hIndex
-				p.nodeAux = &nodeAux{hIndex: n.Entry.HIndex(), hValue: n.Entry.HValue()}
+				p.nodeAux = &nodeAux{hIndex: n.Entry.HIndexHasher(mt.hasher), hValue: n.Entry.HValueHasher(mt.hasher)}
 				return p, nil
 			}
 		case NodeTypeMiddle:
@@ -698,12 +1058,27 @@ func (mt *MerkleTree) GenerateProof(hIndex *Hash, rootKey *Hash) (*Proof, error)
 	return nil, ErrEntryIndexNotFound
 }
 
+// VerifyProofEntry verifies the Merkle Proof for the entry and root,
+// calculating the hIndex and hValue of the entry with the hash function of the
+// proof.
+func VerifyProofEntry(rootKey *Hash, proof *Proof, e *Entry) bool {
+	hasher, err := proof.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
+	return VerifyProof(rootKey, proof, e.HIndexHasher(hasher), e.HValueHasher(hasher))
+}
+
 // VerifyProof verifies the Merkle Proof for the entry and root.
 func VerifyProof(rootKey *Hash, proof *Proof, hIndex, hValue *Hash) bool {
+	hasher, err := proof.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
 	sibIdx := len(proof.Siblings) - 1
 	var midKey *Hash
 	if proof.Existence {
-		midKey = LeafKey(hIndex, hValue)
+		midKey = leafKeyHasher(hasher, hIndex, hValue)
 	} else {
 		if proof.nodeAux == nil {
 			midKey = &HashZero
@@ -711,7 +1086,7 @@ func VerifyProof(rootKey *Hash, proof *Proof, hIndex, hValue *Hash) bool {
 			if bytes.Equal(hIndex[:], proof.nodeAux.hIndex[:]) {
 				return false
 			}
-			midKey = LeafKey(proof.nodeAux.hIndex, proof.nodeAux.hValue)
+			midKey = leafKeyHasher(hasher, proof.nodeAux.hIndex, proof.nodeAux.hValue)
 		}
 	}
 	path := getPath(int(proof.depth), hIndex)
@@ -724,25 +1099,40 @@ func VerifyProof(rootKey *Hash, proof *Proof, hIndex, hValue *Hash) bool {
 			siblingKey = &HashZero
 		}
 		if path[lvl] {
-			midKey = NewNodeMiddle(siblingKey, midKey).Key()
+			midKey = newNodeMiddleHasher(hasher, siblingKey, midKey).Key()
 		} else {
-			midKey = NewNodeMiddle(midKey, siblingKey).Key()
+			midKey = newNodeMiddleHasher(hasher, midKey, siblingKey).Key()
 		}
 	}
 	return bytes.Equal(rootKey[:], midKey[:])
 }
 
 // GetNode gets a node by key from the MT.  Empty nodes are not stored in the
-// tree; they are all the same and assumed to always exist.
+// tree; they are all the same and assumed to always exist.  If the node cache
+// is enabled (see SetNodeCache), the node is looked up there first.
 func (mt *MerkleTree) GetNode(key *Hash) (*Node, error) {
 	if bytes.Equal(key[:], HashZero[:]) {
 		return NewNodeEmpty(), nil
 	}
+	if mt.cache != nil {
+		if n, ok := mt.cache.get(key); ok {
+			return n, nil
+		}
+	}
 	nBytes, err := mt.storage.Get(key[:])
 	if err != nil {
 		return nil, err
 	}
-	return NewNodeFromBytes(nBytes)
+	n, err := NewNodeFromBytes(nBytes)
+	if err != nil {
+		return nil, err
+	}
+	n.hasher = mt.hasher
+	if mt.cache != nil {
+		mt.cache.add(key, n)
+		return cloneNode(n), nil
+	}
+	return n, nil
 }
 
 // addNode adds a node into the MT.  Empty nodes are not stored in the tree;
@@ -756,9 +1146,11 @@ func (mt *MerkleTree) addNode(tx db.Tx, n *Node) (*Hash, error) {
 		return n.Key(), nil
 	}
 	k, v := n.Key(), n.Value()
-	// Check that the node key doesn't already exist
+	// The node key is the hash of its content, so if the key already
+	// exists the same node is already stored (for example, a path that
+	// is restored after a Delete).
 	if _, err := tx.Get(k[:]); err == nil {
-		return nil, ErrNodeKeyAlreadyExists
+		return k, nil
 	}
 	tx.Put(k[:], v)
 	return k, nil
@@ -783,6 +1175,26 @@ func (mt *MerkleTree) dbGet(k []byte) (NodeType, []byte, error) {
 	return NodeType(nodeType), nodeBytes, nil
 }
 
+// dbGetHashKind returns the kind of hash function recorded in the storage.
+// Merkle Trees created before the hash function was recorded in the storage
+// use Poseidon.
+func (mt *MerkleTree) dbGetHashKind() (HashKind, error) {
+	_, kindBytes, err := mt.dbGet(hashKindValue)
+	if err == db.ErrNotFound {
+		return HashKindPoseidon, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(kindBytes) != 1 {
+		return 0, ErrInvalidHashKind
+	}
+	kind := HashKind(kindBytes[0])
+	if _, err := kind.Hasher(); err != nil {
+		return 0, err
+	}
+	return kind, nil
+}
+
 func (mt *MerkleTree) dbInsert(tx db.Tx, k []byte, t NodeType, data []byte) {
 	v := append([]byte{byte(t)}, data...)
 	tx.Put(k, v)
@@ -43,6 +43,27 @@ func TestNewMT(t *testing.T) {
 		mt.RootKey().Hex())
 }
 
+func TestOpenMT(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	defer sto.Close()
+	_, err := OpenMerkleTree(sto, 140)
+	assert.Equal(t, db.ErrNotFound, err)
+	// Nothing is written to the storage
+	_, err = sto.WithPrefix(PREFIX_MERKLETREE).Get(rootNodeValue)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	mt, err := NewMerkleTreeHash(sto, 140, HashKindMimc7)
+	assert.Nil(t, err)
+	e := NewEntryFromInts(1, 2, 3, 4)
+	assert.Nil(t, mt.Add(&e))
+	openMt, err := OpenMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, mt.RootKey(), openMt.RootKey())
+	assert.Equal(t, HashKindMimc7, openMt.HashKind())
+	e2 := NewEntryFromInts(5, 6, 7, 8)
+	assert.Equal(t, ErrNotWritable, openMt.Add(&e2))
+}
+
 func TestEntry(t *testing.T) {
 	e := NewEntryFromInts(12, 45, 78, 41)
 	assert.Equal(t,
@@ -788,3 +809,203 @@ func TestEntryToBytesToEntry(t *testing.T) {
 		assert.True(t, ok)
 	}
 }
+
+func TestDeleteEntry(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mtExpected := newTestingMerkle(t, 140)
+	defer mtExpected.Storage().Close()
+	for i := 0; i < 16; i++ {
+		if i == 3 || i == 10 {
+			continue
+		}
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mtExpected.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e3 := NewEntryFromInts(0, 3, 0, 3)
+	e10 := NewEntryFromInts(0, 10, 0, 10)
+	assert.Nil(t, mt.Delete(e3.HIndex()))
+	assert.Nil(t, mt.Delete(e10.HIndex()))
+	assert.Equal(t, mtExpected.RootKey().Hex(), mt.RootKey().Hex())
+
+	_, err := mt.GetDataByIndex(e3.HIndex())
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+	assert.Equal(t, ErrEntryIndexNotFound, mt.Delete(e3.HIndex()))
+
+	// Adding the entries again restores the previous root
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt2.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Nil(t, mt.Add(&e3))
+	assert.Nil(t, mt.Add(&e10))
+	assert.Equal(t, mt2.RootKey().Hex(), mt.RootKey().Hex())
+}
+
+func TestDeleteAllEntries(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 7; i >= 0; i-- {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt.Delete(e.HIndex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, HashZero.Hex(), mt.RootKey().Hex())
+
+	// Reopening the MerkleTree loads the stored root
+	mtReopened, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	assert.Equal(t, HashZero.Hex(), mtReopened.RootKey().Hex())
+}
+
+func TestDeleteEntryNotWritable(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	e := NewEntryFromInts(12, 45, 78, 41)
+	if err := mt.Add(&e); err != nil {
+		t.Fatal(err)
+	}
+	mtSnapshot, err := mt.Snapshot(mt.RootKey())
+	assert.Nil(t, err)
+	assert.Equal(t, ErrNotWritable, mtSnapshot.Delete(e.HIndex()))
+}
+
+func TestVerifyProofAfterDelete(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRoot := mt.RootKey()
+
+	e := NewEntryFromInts(0, 0, 0, int64(4))
+	assert.Nil(t, mt.Delete(e.HIndex()))
+
+	// Non-existence proof in the current root
+	proof, err := mt.GenerateProof(e.HIndex(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, proof.Existence)
+	assert.True(t, VerifyProof(mt.RootKey(), proof, e.HIndex(), e.HValue()))
+
+	// Existence proof in the old root
+	proof, err = mt.GenerateProof(e.HIndex(), oldRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, proof.Existence)
+	assert.True(t, VerifyProof(oldRoot, proof, e.HIndex(), e.HValue()))
+
+	// The remaining entries still have valid existence proofs
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			continue
+		}
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		proof, err := mt.GenerateProof(e.HIndex(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, true, proof.Existence)
+		assert.True(t, VerifyProof(mt.RootKey(), proof, e.HIndex(), e.HValue()))
+	}
+}
+
+func TestUpdateEntry(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mtExpected := newTestingMerkle(t, 140)
+	defer mtExpected.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if i == 5 {
+			e = NewEntryFromInts(1, 55, 0, int64(i))
+		}
+		if err := mtExpected.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prevRoot := mt.RootKey()
+	e := NewEntryFromInts(1, 55, 0, 5)
+	oldRoot, newRoot, err := mt.Update(&e)
+	assert.Nil(t, err)
+	assert.Equal(t, prevRoot, oldRoot)
+	assert.Equal(t, mt.RootKey(), newRoot)
+	assert.Equal(t, mtExpected.RootKey().Hex(), newRoot.Hex())
+
+	data, err := mt.GetDataByIndex(e.HIndex())
+	assert.Nil(t, err)
+	assert.Equal(t, e.Data, *data)
+
+	// The old root still contains the old value
+	mtOld, err := mt.Snapshot(oldRoot)
+	assert.Nil(t, err)
+	data, err = mtOld.GetDataByIndex(e.HIndex())
+	assert.Nil(t, err)
+	assert.Equal(t, IntsToData(0, 5, 0, 5), *data)
+
+	proof, err := mt.GenerateProof(e.HIndex(), nil)
+	assert.Nil(t, err)
+	assert.True(t, VerifyProof(newRoot, proof, e.HIndex(), e.HValue()))
+}
+
+func TestUpdateEntryNotFound(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	e := NewEntryFromInts(12, 45, 78, 41)
+	_, _, err := mt.Update(&e)
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+
+	if err := mt.Add(&e); err != nil {
+		t.Fatal(err)
+	}
+	e1 := NewEntryFromInts(12, 45, 78, 42)
+	_, _, err = mt.Update(&e1)
+	assert.Equal(t, ErrEntryIndexNotFound, err)
+
+	mtSnapshot, err := mt.Snapshot(mt.RootKey())
+	assert.Nil(t, err)
+	_, _, err = mtSnapshot.Update(&e)
+	assert.Equal(t, ErrNotWritable, err)
+}
@@ -0,0 +1,398 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+
+	common3 "github.com/iden3/go-iden3-core/common"
+)
+
+var (
+	// ErrNoHIndexes is used when a MultiProof is requested for an empty
+	// list of hIndexes.
+	ErrNoHIndexes = errors.New("no hIndexes to generate the multiproof")
+	// ErrTooManyHIndexes is used when a MultiProof is requested for more
+	// hIndexes than the ones that fit in its serialization.
+	ErrTooManyHIndexes = errors.New("too many hIndexes to generate the multiproof")
+)
+
+// multiProofHeaderLen is the length of the header of a serialized MultiProof:
+// 1 byte of flags, 2 bytes for the number of hIndexes and 4 bytes for the
+// number of siblings (including the empty ones).
+const multiProofHeaderLen = 1 + 2 + 4
+
+// MultiProof defines the required elements for the MT proofs of existence or
+// non-existence of several entries against the same root.  The paths of the
+// entries are proven together, so that the siblings shared by several paths
+// are only included once, and the siblings that are part of the path of
+// another entry are not included at all.
+type MultiProof struct {
+	// Existence indicates for each hIndex wether the proof is of existence
+	// or non-existence.
+	Existence []bool
+	// depths indicates for each hIndex how deep in the tree the proof goes.
+	depths []uint
+	// nodeAux is the leaf found in the path of each hIndex for proofs of
+	// non-existence, if any.
+	nodeAux []*nodeAux
+	// numSiblings is the number of siblings of the proof, including the
+	// empty ones.
+	numSiblings uint
+	// notempties is a bitmap of non-empty Siblings found in Siblings.
+	notempties []byte
+	// Siblings is a list of non-empty sibling keys, in the order in which
+	// they are found traversing the tree depth first, left before right.
+	Siblings []*Hash
+	// HashKind is the kind of hash function of the MT of the proof.
+	HashKind HashKind
+}
+
+// addSibling appends a sibling key to the MultiProof.
+func (p *MultiProof) addSibling(key *Hash) {
+	if p.numSiblings/8 >= uint(len(p.notempties)) {
+		p.notempties = append(p.notempties, 0)
+	}
+	if !bytes.Equal(key[:], HashZero[:]) {
+		setBit(p.notempties, p.numSiblings)
+		p.Siblings = append(p.Siblings, key)
+	}
+	p.numSiblings++
+}
+
+// NewMultiProofFromBytes parses a byte array into a MultiProof.
+func NewMultiProofFromBytes(bs []byte) (*MultiProof, error) {
+	if len(bs) < multiProofHeaderLen {
+		return nil, ErrInvalidProofBytes
+	}
+	p := &MultiProof{}
+	p.HashKind = HashKind((bs[0] >> 2) & 0x03)
+	if _, err := p.HashKind.Hasher(); err != nil {
+		return nil, ErrInvalidProofBytes
+	}
+	n := int(binary.BigEndian.Uint16(bs[1:3]))
+	p.numSiblings = uint(binary.BigEndian.Uint32(bs[3:multiProofHeaderLen]))
+	notemptiesLen := int((p.numSiblings + 7) / 8)
+	bs = bs[multiProofHeaderLen:]
+	if len(bs) < 2*n+notemptiesLen {
+		return nil, ErrInvalidProofBytes
+	}
+
+	p.Existence = make([]bool, n)
+	p.depths = make([]uint, n)
+	p.nodeAux = make([]*nodeAux, n)
+	flags := bs[:2*n]
+	p.notempties = make([]byte, notemptiesLen)
+	copy(p.notempties, bs[2*n:2*n+notemptiesLen])
+	bs = bs[2*n+notemptiesLen:]
+	for i := uint(0); i < p.numSiblings; i++ {
+		if testBit(p.notempties, i) {
+			if len(bs) < ElemBytesLen {
+				return nil, ErrInvalidProofBytes
+			}
+			var sib Hash
+			copy(sib[:], bs[:ElemBytesLen])
+			p.Siblings = append(p.Siblings, &sib)
+			bs = bs[ElemBytesLen:]
+		}
+	}
+	for i := 0; i < n; i++ {
+		if (flags[2*i] & 0x01) == 0 {
+			p.Existence[i] = true
+		}
+		p.depths[i] = uint(flags[2*i+1])
+		if !p.Existence[i] && ((flags[2*i] & 0x02) != 0) {
+			if len(bs) < 2*ElemBytesLen {
+				return nil, ErrInvalidProofBytes
+			}
+			p.nodeAux[i] = &nodeAux{hIndex: &Hash{}, hValue: &Hash{}}
+			copy(p.nodeAux[i].hIndex[:], bs[:ElemBytesLen])
+			copy(p.nodeAux[i].hValue[:], bs[ElemBytesLen:2*ElemBytesLen])
+			bs = bs[2*ElemBytesLen:]
+		}
+	}
+	if len(bs) != 0 {
+		return nil, ErrInvalidProofBytes
+	}
+	return p, nil
+}
+
+// Bytes serializes a MultiProof into a byte array.
+func (p *MultiProof) Bytes() []byte {
+	var buf bytes.Buffer
+	header := make([]byte, multiProofHeaderLen)
+	header[0] |= byte(p.HashKind) << 2
+	binary.BigEndian.PutUint16(header[1:3], uint16(len(p.Existence)))
+	binary.BigEndian.PutUint32(header[3:multiProofHeaderLen], uint32(p.numSiblings))
+	buf.Write(header)
+	for i := range p.Existence {
+		var flags byte
+		if !p.Existence[i] {
+			flags |= 0x01
+		}
+		if p.nodeAux[i] != nil {
+			flags |= 0x02
+		}
+		buf.Write([]byte{flags, byte(p.depths[i])})
+	}
+	buf.Write(p.notempties)
+	for _, k := range p.Siblings {
+		buf.Write(k[:])
+	}
+	for _, aux := range p.nodeAux {
+		if aux != nil {
+			buf.Write(aux.hIndex[:])
+			buf.Write(aux.hValue[:])
+		}
+	}
+	return buf.Bytes()
+}
+
+func (p *MultiProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(common3.HexEncode(p.Bytes()))
+}
+
+func (p *MultiProof) UnmarshalJSON(bs []byte) error {
+	proofBytes, err := common3.UnmarshalJSONHexDecode(bs)
+	if err != nil {
+		return err
+	}
+	proof, err := NewMultiProofFromBytes(proofBytes)
+	if err != nil {
+		return err
+	}
+	*p = *proof
+	return nil
+}
+
+// generateMultiProof recursively traverses the tree from the node with key at
+// level lvl, following the paths of the hIndexes in idxs, and fills the
+// MultiProof.
+func (mt *MerkleTree) generateMultiProof(p *MultiProof, key *Hash, lvl int,
+	idxs []int, hIndexes []*Hash, paths [][]bool) error {
+	if lvl > mt.maxLevels-1 {
+		return ErrEntryIndexNotFound
+	}
+	n, err := mt.GetNode(key)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case NodeTypeEmpty:
+		for _, i := range idxs {
+			p.depths[i] = uint(lvl)
+		}
+		return nil
+	case NodeTypeLeaf:
+		hIndex := n.Entry.HIndexHasher(mt.hasher)
+		for _, i := range idxs {
+			p.depths[i] = uint(lvl)
+			if bytes.Equal(hIndexes[i][:], hIndex[:]) {
+				p.Existence[i] = true
+			} else {
+				// We found a leaf whose entry didn't match hIndex
+				p.nodeAux[i] = &nodeAux{hIndex: hIndex, hValue: n.Entry.HValueHasher(mt.hasher)}
+			}
+		}
+		return nil
+	case NodeTypeMiddle:
+		var idxsL, idxsR []int
+		for _, i := range idxs {
+			if paths[i][lvl] {
+				idxsR = append(idxsR, i)
+			} else {
+				idxsL = append(idxsL, i)
+			}
+		}
+		// The sibling is only needed when it's not in the path of
+		// another hIndex
+		if len(idxsL) == 0 {
+			p.addSibling(n.ChildL)
+		} else if len(idxsR) == 0 {
+			p.addSibling(n.ChildR)
+		}
+		if len(idxsL) != 0 {
+			if err := mt.generateMultiProof(p, n.ChildL, lvl+1, idxsL, hIndexes, paths); err != nil {
+				return err
+			}
+		}
+		if len(idxsR) != 0 {
+			if err := mt.generateMultiProof(p, n.ChildR, lvl+1, idxsR, hIndexes, paths); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// GenerateMultiProof generates a single proof of existence (or non-existence)
+// of several Entries' hash Indexes for a Merkle Tree given the root.
+// If the rootKey is nil, the current merkletree root is used
+func (mt *MerkleTree) GenerateMultiProof(hIndexes []*Hash, rootKey *Hash) (*MultiProof, error) {
+	if len(hIndexes) == 0 {
+		return nil, ErrNoHIndexes
+	} else if len(hIndexes) > math.MaxUint16 {
+		return nil, ErrTooManyHIndexes
+	}
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	n := len(hIndexes)
+	p := &MultiProof{
+		Existence: make([]bool, n),
+		depths:    make([]uint, n),
+		nodeAux:   make([]*nodeAux, n),
+		HashKind:  mt.hasher.Kind(),
+	}
+	idxs := make([]int, n)
+	paths := make([][]bool, n)
+	for i, hIndex := range hIndexes {
+		idxs[i] = i
+		paths[i] = getPath(mt.maxLevels, hIndex)
+	}
+	if err := mt.generateMultiProof(p, rootKey, 0, idxs, hIndexes, paths); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// multiProofVerifier holds the state of the verification of a MultiProof.
+type multiProofVerifier struct {
+	proof    *MultiProof
+	hasher   Hasher
+	hIndexes []*Hash
+	hValues  []*Hash
+	paths    [][]bool
+	// sibling is the position of the next sibling, including the empty
+	// ones, and sibIdx the position of the next non-empty one.
+	sibling uint
+	sibIdx  int
+}
+
+// nextSibling returns the next sibling key of the MultiProof.
+func (v *multiProofVerifier) nextSibling() (*Hash, bool) {
+	if v.sibling >= v.proof.numSiblings {
+		return nil, false
+	}
+	defer func() { v.sibling++ }()
+	if !testBit(v.proof.notempties, v.sibling) {
+		return &HashZero, true
+	}
+	if v.sibIdx >= len(v.proof.Siblings) {
+		return nil, false
+	}
+	v.sibIdx++
+	return v.proof.Siblings[v.sibIdx-1], true
+}
+
+// leafKey returns the key of the node at the end of the path of the hIndex i.
+func (v *multiProofVerifier) leafKey(i int) (*Hash, bool) {
+	if v.proof.Existence[i] {
+		return leafKeyHasher(v.hasher, v.hIndexes[i], v.hValues[i]), true
+	}
+	aux := v.proof.nodeAux[i]
+	if aux == nil {
+		return &HashZero, true
+	}
+	if bytes.Equal(v.hIndexes[i][:], aux.hIndex[:]) {
+		return nil, false
+	}
+	return leafKeyHasher(v.hasher, aux.hIndex, aux.hValue), true
+}
+
+// nodeKey recursively computes the key of the node at level lvl in the paths
+// of the hIndexes in idxs.
+func (v *multiProofVerifier) nodeKey(lvl uint, idxs []int) (*Hash, bool) {
+	var key *Hash
+	for _, i := range idxs {
+		if v.proof.depths[i] != lvl {
+			continue
+		}
+		// All the paths that reach the end at this level must
+		// lead to the same node
+		k, ok := v.leafKey(i)
+		if !ok || (key != nil && !bytes.Equal(key[:], k[:])) {
+			return nil, false
+		}
+		key = k
+	}
+	if key != nil {
+		for _, i := range idxs {
+			if v.proof.depths[i] != lvl {
+				return nil, false
+			}
+		}
+		return key, true
+	}
+	var idxsL, idxsR []int
+	for _, i := range idxs {
+		if v.paths[i][lvl] {
+			idxsR = append(idxsR, i)
+		} else {
+			idxsL = append(idxsL, i)
+		}
+	}
+	var keyL, keyR *Hash
+	var ok bool
+	if len(idxsL) == 0 {
+		if keyL, ok = v.nextSibling(); !ok {
+			return nil, false
+		}
+	} else if len(idxsR) == 0 {
+		if keyR, ok = v.nextSibling(); !ok {
+			return nil, false
+		}
+	}
+	if len(idxsL) != 0 {
+		if keyL, ok = v.nodeKey(lvl+1, idxsL); !ok {
+			return nil, false
+		}
+	}
+	if len(idxsR) != 0 {
+		if keyR, ok = v.nodeKey(lvl+1, idxsR); !ok {
+			return nil, false
+		}
+	}
+	return newNodeMiddleHasher(v.hasher, keyL, keyR).Key(), true
+}
+
+// VerifyMultiProof verifies the Merkle MultiProof for the entries and root.
+// The hIndexes and hValues of the entries must be in the same order as the
+// hIndexes used to generate the MultiProof.  As in VerifyProof, the hValues
+// of the entries proven not to exist are not used.
+func VerifyMultiProof(rootKey *Hash, proof *MultiProof, hIndexes, hValues []*Hash) bool {
+	hasher, err := proof.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
+	n := len(hIndexes)
+	if n == 0 || len(hValues) != n || len(proof.Existence) != n ||
+		len(proof.depths) != n || len(proof.nodeAux) != n {
+		return false
+	}
+	v := multiProofVerifier{
+		proof:    proof,
+		hasher:   hasher,
+		hIndexes: hIndexes,
+		hValues:  hValues,
+		paths:    make([][]bool, n),
+	}
+	idxs := make([]int, n)
+	for i, hIndex := range hIndexes {
+		idxs[i] = i
+		v.paths[i] = getPath(int(proof.depths[i]), hIndex)
+	}
+	midKey, ok := v.nodeKey(0, idxs)
+	if !ok {
+		return false
+	}
+	// All the siblings must have been used
+	if v.sibling != proof.numSiblings || v.sibIdx != len(proof.Siblings) {
+		return false
+	}
+	return bytes.Equal(rootKey[:], midKey[:])
+}
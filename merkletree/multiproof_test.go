@@ -0,0 +1,176 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func multiProofEntries(from, to int) ([]*Hash, []*Hash) {
+	var hIndexes, hValues []*Hash
+	for i := from; i < to; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		hIndexes = append(hIndexes, e.HIndex())
+		hValues = append(hValues, e.HValue())
+	}
+	return hIndexes, hValues
+}
+
+func TestMultiProof(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entries 24 to 39, the last half of them are not in the tree
+	hIndexes, hValues := multiProofEntries(24, 40)
+	proof, err := mt.GenerateMultiProof(hIndexes, nil)
+	assert.Nil(t, err)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+
+	siblingsLen := 0
+	for i, hIndex := range hIndexes {
+		p, err := mt.GenerateProof(hIndex, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, p.Existence, proof.Existence[i])
+		assert.Equal(t, p.depth, proof.depths[i])
+		assert.Equal(t, p.nodeAux, proof.nodeAux[i])
+		siblingsLen += len(p.Siblings)
+	}
+	assert.True(t, len(proof.Siblings) < siblingsLen)
+
+	// Wrong root, values or number of entries
+	assert.False(t, VerifyMultiProof(&HashZero, proof, hIndexes, hValues))
+	hValues[0], hValues[1] = hValues[1], hValues[0]
+	assert.False(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+	hValues[0], hValues[1] = hValues[1], hValues[0]
+	assert.False(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes[1:], hValues[1:]))
+
+	// The entries that don't exist can't be proven to exist
+	proof.Existence[15] = true
+	assert.False(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+}
+
+func TestMultiProofSingleEntry(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := mt.RootKey()
+	e := NewEntryFromInts(0, 0, 0, 8)
+	assert.Nil(t, mt.Add(&e))
+
+	// A multiproof of a single entry has the same siblings as a proof
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		p, err := mt.GenerateProof(e.HIndex(), root)
+		assert.Nil(t, err)
+		proof, err := mt.GenerateMultiProof([]*Hash{e.HIndex()}, root)
+		assert.Nil(t, err)
+		assert.Equal(t, p.Siblings, proof.Siblings)
+		assert.True(t, VerifyMultiProof(root, proof, []*Hash{e.HIndex()}, []*Hash{e.HValue()}))
+	}
+}
+
+func TestMultiProofEmptyTree(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	hIndexes, hValues := multiProofEntries(0, 4)
+	proof, err := mt.GenerateMultiProof(hIndexes, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(proof.Siblings))
+	assert.Equal(t, []bool{false, false, false, false}, proof.Existence)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+
+	_, err = mt.GenerateMultiProof(nil, nil)
+	assert.Equal(t, ErrNoHIndexes, err)
+}
+
+func TestMultiProofRepeatedHIndex(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hIndexes, hValues := multiProofEntries(2, 4)
+	hIndexes = append(hIndexes, hIndexes[0])
+	hValues = append(hValues, hValues[0])
+	proof, err := mt.GenerateMultiProof(hIndexes, nil)
+	assert.Nil(t, err)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+}
+
+func TestMultiProofBytes(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hIndexes, hValues := multiProofEntries(28, 36)
+	proof, err := mt.GenerateMultiProof(hIndexes, nil)
+	assert.Nil(t, err)
+
+	proof2, err := NewMultiProofFromBytes(proof.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, proof, proof2)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof2, hIndexes, hValues))
+
+	proofJSON, err := json.Marshal(proof)
+	assert.Nil(t, err)
+	var proof3 MultiProof
+	assert.Nil(t, json.Unmarshal(proofJSON, &proof3))
+	assert.Equal(t, proof, &proof3)
+
+	bs := proof.Bytes()
+	_, err = NewMultiProofFromBytes(bs[:len(bs)-1])
+	assert.Equal(t, ErrInvalidProofBytes, err)
+	_, err = NewMultiProofFromBytes(append(bs, 0))
+	assert.Equal(t, ErrInvalidProofBytes, err)
+}
+
+func TestMultiProofMimc7(t *testing.T) {
+	mt, err := NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+
+	var hIndexes, hValues []*Hash
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, 0, 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			hIndexes = append(hIndexes, e.HIndexHasher(mt.Hasher()))
+			hValues = append(hValues, e.HValueHasher(mt.Hasher()))
+		}
+	}
+	proof, err := mt.GenerateMultiProof(hIndexes, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashKindMimc7, proof.HashKind)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof, hIndexes, hValues))
+
+	proof2, err := NewMultiProofFromBytes(proof.Bytes())
+	assert.Nil(t, err)
+	assert.True(t, VerifyMultiProof(mt.RootKey(), proof2, hIndexes, hValues))
+}
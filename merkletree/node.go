@@ -18,6 +18,12 @@ const (
 
 	// DBEntryTypeRoot indicates the type of a DB entry that indicates the current Root of a MerkleTree
 	DBEntryTypeRoot NodeType = 3
+	// DBEntryTypeHashKind indicates the type of a DB entry that indicates the kind of hash function of a MerkleTree
+	DBEntryTypeHashKind NodeType = 4
+	// DBEntryTypeRootLog indicates the type of a DB entry of the log of Roots of a MerkleTree
+	DBEntryTypeRootLog NodeType = 5
+	// DBEntryTypeStats indicates the type of a DB entry of the statistics of a MerkleTree
+	DBEntryTypeStats NodeType = 6
 )
 
 // Node is the struct that represents a node in the MT. The node should not be
@@ -33,6 +39,9 @@ type Node struct {
 	Entry *Entry
 	// key is a cache used to avoid recalculating key
 	key *Hash
+	// hasher is the hash function used to calculate key.  If it's nil, the
+	// default hash function is used.
+	hasher Hasher
 }
 
 // NewNodeLeaf creates a new leaf node.
@@ -50,6 +59,18 @@ func NewNodeEmpty() *Node {
 	return &Node{Type: NodeTypeEmpty}
 }
 
+// newNodeLeafHasher creates a new leaf node whose key is calculated with the
+// hash function hasher.
+func newNodeLeafHasher(hasher Hasher, entry *Entry) *Node {
+	return &Node{Type: NodeTypeLeaf, Entry: entry, hasher: hasher}
+}
+
+// newNodeMiddleHasher creates a new middle node whose key is calculated with
+// the hash function hasher.
+func newNodeMiddleHasher(hasher Hasher, childL *Hash, childR *Hash) *Node {
+	return &Node{Type: NodeTypeMiddle, ChildL: childL, ChildR: childR, hasher: hasher}
+}
+
 // NewNodeFromBytes creates a new node by parsing the input []byte.
 func NewNodeFromBytes(b []byte) (*Node, error) {
 	if len(b) < 1 {
@@ -84,8 +105,21 @@ func NewNodeFromBytes(b []byte) (*Node, error) {
 // LeafKey computes the key of a leaf node given the hIndex and hValue of the
 // entry of the leaf.
 func LeafKey(hIndex, hValue *Hash) *Hash {
+	return leafKeyHasher(HasherPoseidon, hIndex, hValue)
+}
+
+// leafKeyHasher computes the key of a leaf node with the hash function hasher.
+func leafKeyHasher(hasher Hasher, hIndex, hValue *Hash) *Hash {
 	// return HashElems(ElemBytesOne, ElemBytes(*hIndex), ElemBytes(*hValue))
-	return HashElemsKey(big.NewInt(1), ElemBytes(*hIndex), ElemBytes(*hValue))
+	return hasher.HashElemsKey(big.NewInt(1), ElemBytes(*hIndex), ElemBytes(*hValue))
+}
+
+// hashFn returns the hash function used to calculate the key of the node.
+func (n *Node) hashFn() Hasher {
+	if n.hasher == nil {
+		return HasherPoseidon
+	}
+	return n.hasher
 }
 
 // Key computes the key of the node by hashing the content in a specific way
@@ -96,9 +130,10 @@ func (n *Node) Key() *Hash {
 		// NOTE: We are not using the type to calculate the hash!
 		switch n.Type {
 		case NodeTypeMiddle: // H(ChildL || ChildR)
-			n.key = HashElems(ElemBytes(*n.ChildL), ElemBytes(*n.ChildR))
+			n.key = n.hashFn().HashElems(ElemBytes(*n.ChildL), ElemBytes(*n.ChildR))
 		case NodeTypeLeaf: // H(Data...)
-			n.key = LeafKey(n.Entry.HIndex(), n.Entry.HValue())
+			h := n.hashFn()
+			n.key = leafKeyHasher(h, n.Entry.HIndexHasher(h), n.Entry.HValueHasher(h))
 		case NodeTypeEmpty: // Zero
 			n.key = &HashZero
 		default:
@@ -0,0 +1,109 @@
+package merkletree
+
+// markReachable adds to reachable the keys of all the nodes of the tree with
+// the given root key.  Subtrees whose root has already been marked are not
+// traversed again, so that the nodes shared between roots are only visited
+// once.
+func (mt *MerkleTree) markReachable(key *Hash, reachable map[Hash]struct{}) error {
+	if *key == HashZero {
+		return nil
+	}
+	if _, ok := reachable[*key]; ok {
+		return nil
+	}
+	n, err := mt.GetNode(key)
+	if err != nil {
+		return err
+	}
+	reachable[*key] = struct{}{}
+	switch n.Type {
+	case NodeTypeLeaf:
+		return nil
+	case NodeTypeMiddle:
+		if err := mt.markReachable(n.ChildL, reachable); err != nil {
+			return err
+		}
+		return mt.markReachable(n.ChildR, reachable)
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// isStoredNode returns true if the key and value found in the storage of the
+// MT belong to a node.  Other values such as the current root, the hash kind
+// or the data stored under a longer prefix (for example the trees nested in
+// the storage of this one) are not nodes.
+func isStoredNode(k, v []byte) bool {
+	if len(k) != ElemBytesLen {
+		return false
+	}
+	_, err := NewNodeFromBytes(v)
+	return err == nil
+}
+
+// Prune deletes from the storage all the nodes of the MerkleTree that are not
+// reachable from the current root or from any of the retainRoots, and returns
+// the number of nodes deleted.  After pruning, Snapshot and GenerateProof
+// keep working for the retained roots, but not for any other past root.  The
+// roots of the log of roots that are not retained are kept in the log marked
+// as Pruned, so that RootAt still finds them but SnapshotAt returns
+// ErrRootPruned.  The MerkleTree is locked while pruning, so it can't be
+// modified meanwhile.
+func (mt *MerkleTree) Prune(retainRoots []*Hash) (int, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return 0, ErrNotWritable
+	}
+	mt.Lock()
+	defer mt.Unlock()
+
+	// mark
+	reachable := make(map[Hash]struct{})
+	for _, root := range append([]*Hash{mt.rootKey}, retainRoots...) {
+		if err := mt.markReachable(root, reachable); err != nil {
+			return 0, err
+		}
+	}
+
+	// sweep
+	var unreachable [][]byte
+	err := mt.storage.Iterate(func(k, v []byte) (bool, error) {
+		if !isStoredNode(k, v) {
+			return true, nil
+		}
+		var key Hash
+		copy(key[:], k)
+		if _, ok := reachable[key]; !ok {
+			unreachable = append(unreachable, key[:])
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(unreachable) == 0 {
+		return 0, nil
+	}
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range unreachable {
+		tx.Delete(k)
+	}
+	if _, err := mt.pruneRootLog(tx, reachable); err != nil {
+		tx.Close()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if mt.cache != nil {
+		for _, k := range unreachable {
+			var key Hash
+			copy(key[:], k)
+			mt.cache.remove(&key)
+		}
+	}
+	return len(unreachable), nil
+}
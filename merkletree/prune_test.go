@@ -0,0 +1,185 @@
+package merkletree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func countStoredNodes(t *testing.T, mt *MerkleTree) int {
+	n := 0
+	err := mt.Storage().Iterate(func(k, v []byte) (bool, error) {
+		if isStoredNode(k, v) {
+			n++
+		}
+		return true, nil
+	})
+	assert.Nil(t, err)
+	return n
+}
+
+func countReachableNodes(t *testing.T, mt *MerkleTree, roots ...*Hash) int {
+	reachable := make(map[Hash]struct{})
+	for _, root := range roots {
+		err := mt.Walk(root, func(n *Node) {
+			if n.Type != NodeTypeEmpty {
+				reachable[*n.Key()] = struct{}{}
+			}
+		})
+		assert.Nil(t, err)
+	}
+	return len(reachable)
+}
+
+func TestPrune(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	var roots []*Hash
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, mt.RootKey())
+	}
+	root7 := roots[7]
+	nodes := countStoredNodes(t, mt)
+
+	pruned, err := mt.Prune([]*Hash{root7})
+	assert.Nil(t, err)
+	assert.True(t, pruned > 0)
+	assert.Equal(t, nodes-pruned, countStoredNodes(t, mt))
+	assert.Equal(t, countReachableNodes(t, mt, mt.RootKey(), root7), countStoredNodes(t, mt))
+
+	// Pruning again doesn't find anything to delete
+	pruned, err = mt.Prune([]*Hash{root7})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pruned)
+
+	// The current root and the retained root are still usable
+	snapshot, err := mt.Snapshot(root7)
+	assert.Nil(t, err)
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		proof, err := mt.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.True(t, proof.Existence)
+		assert.True(t, VerifyProof(mt.RootKey(), proof, e.HIndex(), e.HValue()))
+
+		proof, err = snapshot.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, i <= 7, proof.Existence)
+		assert.True(t, VerifyProof(root7, proof, e.HIndex(), e.HValue()))
+	}
+
+	// The roots that have not been retained are gone
+	e0 := NewEntryFromInts(0, 0, 0, 0)
+	_, err = mt.GenerateProof(e0.HIndex(), roots[3])
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// The tree can be modified after pruning
+	e := NewEntryFromInts(0, 16, 0, 16)
+	assert.Nil(t, mt.Add(&e))
+	_, err = mt.Prune(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, countReachableNodes(t, mt, mt.RootKey()), countStoredNodes(t, mt))
+}
+
+func TestPruneKeepsOtherData(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mtSto := sto.WithPrefix([]byte(PREFIX_MERKLETREE))
+	mt, err := NewMerkleTree(mtSto, 140)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+
+	// A tree nested in the storage of mt
+	mtNested, err := NewMerkleTree(mtSto.WithPrefix([]byte("nested")), 140)
+	assert.Nil(t, err)
+
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		assert.Nil(t, mt.Add(&e))
+		assert.Nil(t, mtNested.Add(&e))
+	}
+	pruned, err := mt.Prune(nil)
+	assert.Nil(t, err)
+	assert.True(t, pruned > 0)
+
+	// The state of mt is still stored
+	mt2, err := NewMerkleTree(sto.WithPrefix([]byte(PREFIX_MERKLETREE)), 140)
+	assert.Nil(t, err)
+	assert.Equal(t, mt.RootKey().Hex(), mt2.RootKey().Hex())
+	assert.Equal(t, mt.HashKind(), mt2.HashKind())
+
+	// The nodes of the nested tree are untouched, including the old ones
+	nodes := countStoredNodes(t, mtNested)
+	pruned, err = mtNested.Prune(nil)
+	assert.Nil(t, err)
+	assert.True(t, pruned > 0)
+	assert.Equal(t, nodes-pruned, countStoredNodes(t, mtNested))
+}
+
+func TestPruneNotWritable(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	e := NewEntryFromInts(0, 1, 0, 1)
+	assert.Nil(t, mt.Add(&e))
+
+	snapshot, err := mt.Snapshot(mt.RootKey())
+	assert.Nil(t, err)
+	_, err = snapshot.Prune(nil)
+	assert.Equal(t, ErrNotWritable, err)
+}
+
+func TestPruneRootLog(t *testing.T) {
+	t0 := time.Unix(1500000000, 0)
+	defer setTimeNow(t0)()
+
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, err := mt.Roots(0, 100)
+	assert.Nil(t, err)
+	root7 := log[8].Root
+
+	_, err = mt.Prune([]*Hash{root7})
+	assert.Nil(t, err)
+	logPruned, err := mt.Roots(0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, len(log), len(logPruned))
+	for i, e := range logPruned {
+		assert.Equal(t, log[i].Root, e.Root)
+		assert.Equal(t, log[i].Time, e.Time)
+		_, err := mt.GetNode(e.Root)
+		assert.Equal(t, err != nil, e.Pruned)
+	}
+	// The empty root and the retained roots are not pruned
+	assert.True(t, !logPruned[0].Pruned)
+	assert.True(t, !logPruned[8].Pruned)
+	assert.True(t, !logPruned[16].Pruned)
+	assert.True(t, logPruned[9].Pruned)
+
+	snapshot, err := mt.SnapshotAt(log[8].Time)
+	assert.Nil(t, err)
+	assert.Equal(t, root7, snapshot.RootKey())
+	e, err := mt.RootAt(log[9].Time)
+	assert.Nil(t, err)
+	assert.True(t, e.Pruned)
+	_, err = mt.SnapshotAt(log[9].Time)
+	assert.Equal(t, ErrRootPruned, err)
+
+	// The log keeps growing after pruning
+	entry := NewEntryFromInts(0, 100, 0, 100)
+	assert.Nil(t, mt.Add(&entry))
+	n, err := mt.RootLogLen()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(len(log)+1), n)
+}
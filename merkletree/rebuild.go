@@ -0,0 +1,90 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// ErrRebuildTargetNotEmpty is used when a MT is rebuilt into a storage that
+// already contains a MT that is not empty.
+var ErrRebuildTargetNotEmpty = errors.New("the merkletree where the tree is rebuilt is not empty")
+
+// levelCollisions returns the groups of entries that can't be in the same
+// tree of maxLevels levels because their paths don't diverge before the last
+// level.
+func levelCollisions(hasher Hasher, entries []*Entry, maxLevels int) [][]*Entry {
+	groups := make(map[string]int)
+	var collisions [][]*Entry
+	var grouped [][]*Entry
+	for _, e := range entries {
+		// Two leafs must diverge at most at level maxLevels-2, where
+		// the deepest middle node can be.
+		path := getPath(maxLevels, e.HIndexHasher(hasher))
+		prefix := make([]byte, maxLevels-1)
+		for i := range prefix {
+			if path[i] {
+				prefix[i] = 1
+			}
+		}
+		if i, ok := groups[string(prefix)]; ok {
+			grouped[i] = append(grouped[i], e)
+		} else {
+			groups[string(prefix)] = len(grouped)
+			grouped = append(grouped, []*Entry{e})
+		}
+	}
+	for _, g := range grouped {
+		if len(g) > 1 {
+			collisions = append(collisions, g)
+		}
+	}
+	return collisions
+}
+
+// Rebuild adds all the entries of the tree with the given rootKey (or the
+// current root if rootKey is nil) into the MerkleTree of maxLevels levels in
+// storage, with the same hash function, and returns it.  This allows
+// migrating a tree to a different number of levels or storage prefix.  The
+// storage must contain no tree or an empty one, otherwise nothing is added and
+// ErrRebuildTargetNotEmpty is returned.  If some entries can't be in the same tree of maxLevels
+// levels, nothing is added and they are returned grouped by the entries that
+// collide with each other, with ErrReachedMaxLevel.  If maxLevels is less than
+// 1, ErrInvalidMaxLevels is returned.
+func (mt *MerkleTree) Rebuild(rootKey *Hash, storage db.Storage, maxLevels int) (*MerkleTree, [][]*Entry, error) {
+	if maxLevels < 1 {
+		return nil, nil, ErrInvalidMaxLevels
+	}
+	// The destination leafs would be ignored in the collisions, so only
+	// an empty destination is allowed.
+	if dstMt, err := OpenMerkleTree(storage, maxLevels); err == nil {
+		if !bytes.Equal(dstMt.RootKey()[:], HashZero[:]) {
+			return nil, nil, ErrRebuildTargetNotEmpty
+		}
+	} else if err != db.ErrNotFound {
+		return nil, nil, err
+	}
+	if rootKey == nil {
+		rootKey = mt.RootKey()
+	}
+	var entries []*Entry
+	if err := mt.walkLeaves(rootKey, func(n *Node) error {
+		entries = append(entries, n.Entry)
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	if collisions := levelCollisions(mt.hasher, entries, maxLevels); len(collisions) > 0 {
+		return nil, collisions, ErrReachedMaxLevel
+	}
+
+	newMt, err := NewMerkleTreeHash(storage, maxLevels, mt.HashKind())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := newMt.AddBulk(entries, 0); err != nil {
+		return nil, nil, err
+	}
+	return newMt, nil, nil
+}
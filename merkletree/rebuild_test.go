@@ -0,0 +1,89 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuild(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := mt.RootKey()
+	e := NewEntryFromInts(0, 100, 0, 100)
+	assert.Nil(t, mt.Add(&e))
+
+	// The keys of the nodes don't depend on the number of levels
+	sto := db.NewMemoryStorage()
+	defer sto.Close()
+	mt2, collisions, err := mt.Rebuild(root, sto, 32)
+	assert.Nil(t, err)
+	assert.Nil(t, collisions)
+	assert.Equal(t, root, mt2.RootKey())
+	assert.Equal(t, 32, mt2.MaxLevels())
+	assert.Equal(t, mt.HashKind(), mt2.HashKind())
+	entries, _ := iterateLeafs(t, mt.LeafIterator(root), 0)
+	for _, e := range entries {
+		proof, err := mt2.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.True(t, VerifyProof(mt2.RootKey(), proof, e.HIndex(), e.HValue()))
+	}
+
+	// In the same storage with a different prefix
+	mt3, collisions, err := mt.Rebuild(nil, mt.Storage().WithPrefix([]byte("rebuild")), 64)
+	assert.Nil(t, err)
+	assert.Nil(t, collisions)
+	assert.Equal(t, mt.RootKey(), mt3.RootKey())
+
+	// Into an empty tree
+	sto4 := db.NewMemoryStorage()
+	defer sto4.Close()
+	_, err = NewMerkleTree(sto4, 140)
+	assert.Nil(t, err)
+	mt4, collisions, err := mt.Rebuild(nil, sto4, 140)
+	assert.Nil(t, err)
+	assert.Nil(t, collisions)
+	assert.Equal(t, mt.RootKey(), mt4.RootKey())
+
+	// Not into a tree that is not empty
+	_, _, err = mt.Rebuild(root, sto4, 140)
+	assert.Equal(t, ErrRebuildTargetNotEmpty, err)
+	assert.Equal(t, mt.RootKey(), mt4.RootKey())
+}
+
+func TestRebuildCollisions(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sto := db.NewMemoryStorage()
+	defer sto.Close()
+	_, collisions, err := mt.Rebuild(nil, sto, 4)
+	assert.Equal(t, ErrReachedMaxLevel, err)
+	assert.NotEqual(t, 0, len(collisions))
+	for _, g := range collisions {
+		assert.True(t, len(g) > 1)
+		// The entries of a group can't be in the same tree
+		mtg, err := NewMerkleTree(db.NewMemoryStorage(), 4)
+		assert.Nil(t, err)
+		assert.Equal(t, ErrReachedMaxLevel, mtg.AddBulk(g, 1))
+	}
+	// Nothing is added to the storage
+	_, err = sto.WithPrefix(PREFIX_MERKLETREE).Get(rootNodeValue)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	_, _, err = mt.Rebuild(nil, sto, 0)
+	assert.Equal(t, ErrInvalidMaxLevels, err)
+}
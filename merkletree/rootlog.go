@@ -0,0 +1,220 @@
+package merkletree
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+var (
+	// rootLogPrefix is the prefix of the Keys used to store the log of roots
+	// of the MT in the database, followed by the sequence number.
+	rootLogPrefix = []byte("rootlog")
+	// rootLogLenValue is the Key used to store the number of roots in the
+	// log of roots of the MT in the database.
+	rootLogLenValue = []byte("rootloglen")
+
+	// ErrRootNotFound is used when there is no root in the log of roots
+	// at the requested time.
+	ErrRootNotFound = errors.New("root not found in the root log")
+	// ErrRootPruned is used when the root of the log of roots at the
+	// requested time has been pruned (see MerkleTree.Prune).
+	ErrRootPruned = errors.New("the root of the root log has been pruned")
+
+	// timeNow returns the time recorded in the log of roots.
+	timeNow = time.Now
+)
+
+// RootLogEntry is an entry of the log of the roots of a MT.
+type RootLogEntry struct {
+	// Seq is the position of the root in the log, starting from 0.
+	Seq uint64
+	// Root is the key of the root node.
+	Root *Hash
+	// Time is the time when the MT got the root.
+	Time time.Time
+	// Pruned indicates that the nodes of the root have been deleted by
+	// Prune, so the MT can't be used with this root anymore.
+	Pruned bool
+}
+
+// rootLogKey returns the Key of the root with sequence seq in the log.
+func rootLogKey(seq uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	return append(append([]byte{}, rootLogPrefix...), b[:]...)
+}
+
+// parseRootLogEntry parses the value of the root with sequence seq in the log.
+// The value of a pruned root has a trailing byte.
+func parseRootLogEntry(seq uint64, v []byte) (*RootLogEntry, error) {
+	if (len(v) != 1+ElemBytesLen+8 && len(v) != 1+ElemBytesLen+8+1) ||
+		NodeType(v[0]) != DBEntryTypeRootLog {
+		return nil, ErrInvalidDBValue
+	}
+	root := &Hash{}
+	copy(root[:], v[1:1+ElemBytesLen])
+	nanos := int64(binary.BigEndian.Uint64(v[1+ElemBytesLen : 1+ElemBytesLen+8]))
+	return &RootLogEntry{Seq: seq, Root: root, Time: time.Unix(0, nanos),
+		Pruned: len(v) == 1+ElemBytesLen+8+1}, nil
+}
+
+// value returns the value of the entry of the log of roots stored in the
+// database, without the entry type.
+func (e *RootLogEntry) value() []byte {
+	var nanos [8]byte
+	binary.BigEndian.PutUint64(nanos[:], uint64(e.Time.UnixNano()))
+	v := append(append([]byte{}, e.Root[:]...), nanos[:]...)
+	if e.Pruned {
+		v = append(v, 1)
+	}
+	return v
+}
+
+// rootLogLen returns the number of roots in the log from the value read from
+// rootLogLenValue.
+func rootLogLen(v []byte, err error) (uint64, error) {
+	if err == db.ErrNotFound {
+		// Merkle Trees created before the roots were logged.
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(v) != 1+8 || NodeType(v[0]) != DBEntryTypeRootLog {
+		return 0, ErrInvalidDBValue
+	}
+	return binary.BigEndian.Uint64(v[1:]), nil
+}
+
+// logRoot appends the root to the log of roots in the tx, which must be the
+// same tx where the root is set as the current one.
+func (mt *MerkleTree) logRoot(tx db.Tx, root *Hash) error {
+	n, err := rootLogLen(tx.Get(rootLogLenValue))
+	if err != nil {
+		return err
+	}
+	now := timeNow()
+	// Keep the log sorted by time even if the clock goes backwards.
+	if n > 0 {
+		v, err := tx.Get(rootLogKey(n - 1))
+		if err != nil {
+			return err
+		}
+		last, err := parseRootLogEntry(n-1, v)
+		if err != nil {
+			return err
+		}
+		if now.Before(last.Time) {
+			now = last.Time
+		}
+	}
+	e := RootLogEntry{Seq: n, Root: root, Time: now}
+	mt.dbInsert(tx, rootLogKey(n), DBEntryTypeRootLog, e.value())
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], n+1)
+	mt.dbInsert(tx, rootLogLenValue, DBEntryTypeRootLog, seq[:])
+	return nil
+}
+
+// RootLogLen returns the number of roots in the log of roots of the MT.
+func (mt *MerkleTree) RootLogLen() (uint64, error) {
+	return rootLogLen(mt.storage.Get(rootLogLenValue))
+}
+
+// rootLogEntry returns the root with sequence seq in the log.
+func (mt *MerkleTree) rootLogEntry(seq uint64) (*RootLogEntry, error) {
+	v, err := mt.storage.Get(rootLogKey(seq))
+	if err != nil {
+		return nil, err
+	}
+	return parseRootLogEntry(seq, v)
+}
+
+// Roots returns the roots of the log of roots of the MT with sequence between
+// from (included) and to (excluded).  Every modification of the MT appends
+// its new root to the log.  The roots deleted by Prune are kept in the log
+// marked as Pruned.
+func (mt *MerkleTree) Roots(from, to uint64) ([]RootLogEntry, error) {
+	n, err := mt.RootLogLen()
+	if err != nil {
+		return nil, err
+	}
+	if to > n {
+		to = n
+	}
+	roots := []RootLogEntry{}
+	for seq := from; seq < to; seq++ {
+		e, err := mt.rootLogEntry(seq)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, *e)
+	}
+	return roots, nil
+}
+
+// RootAt returns the entry of the log of roots with the root that the MT had
+// at time t.  If the MT had no logged root at time t, ErrRootNotFound is
+// returned.  The entry may be marked as Pruned.
+func (mt *MerkleTree) RootAt(t time.Time) (*RootLogEntry, error) {
+	n, err := mt.RootLogLen()
+	if err != nil {
+		return nil, err
+	}
+	// Find the first root logged after t
+	var errSearch error
+	i := sort.Search(int(n), func(i int) bool {
+		e, err := mt.rootLogEntry(uint64(i))
+		if err != nil {
+			errSearch = err
+			return true
+		}
+		return e.Time.After(t)
+	})
+	if errSearch != nil {
+		return nil, errSearch
+	}
+	if i == 0 {
+		return nil, ErrRootNotFound
+	}
+	return mt.rootLogEntry(uint64(i - 1))
+}
+
+// SnapshotAt returns a snapshot of the MT with the root it had at time t.  If
+// that root has been pruned, ErrRootPruned is returned.
+func (mt *MerkleTree) SnapshotAt(t time.Time) (*MerkleTree, error) {
+	e, err := mt.RootAt(t)
+	if err != nil {
+		return nil, err
+	}
+	if e.Pruned {
+		return nil, ErrRootPruned
+	}
+	return mt.Snapshot(e.Root)
+}
+
+// pruneRootLog marks as Pruned in the tx the roots of the log of roots that
+// are not in reachable, and returns the number of roots marked.
+func (mt *MerkleTree) pruneRootLog(tx db.Tx, reachable map[Hash]struct{}) (int, error) {
+	n, err := mt.RootLogLen()
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for seq := uint64(0); seq < n; seq++ {
+		e, err := mt.rootLogEntry(seq)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := reachable[*e.Root]; ok || e.Pruned || *e.Root == HashZero {
+			continue
+		}
+		e.Pruned = true
+		mt.dbInsert(tx, rootLogKey(seq), DBEntryTypeRootLog, e.value())
+		pruned++
+	}
+	return pruned, nil
+}
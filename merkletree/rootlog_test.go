@@ -0,0 +1,131 @@
+package merkletree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// setTimeNow makes the root log use a clock that starts at t0 and advances
+// one second every time it's read.
+func setTimeNow(t0 time.Time) func() {
+	now := t0
+	timeNow = func() time.Time {
+		t := now
+		now = now.Add(time.Second)
+		return t
+	}
+	return func() { timeNow = time.Now }
+}
+
+func TestRootLog(t *testing.T) {
+	t0 := time.Unix(1500000000, 0)
+	defer setTimeNow(t0)()
+
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	roots := []*Hash{mt.RootKey()}
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, mt.RootKey())
+	}
+	e := NewEntryFromInts(1, 1, 0, 1)
+	_, _, err := mt.Update(&e)
+	assert.Nil(t, err)
+	roots = append(roots, mt.RootKey())
+	assert.Nil(t, mt.Delete(e.HIndex()))
+	roots = append(roots, mt.RootKey())
+	var entries []*Entry
+	for i := 8; i < 12; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		entries = append(entries, &e)
+	}
+	assert.Nil(t, mt.AddBatch(entries))
+	roots = append(roots, mt.RootKey())
+
+	n, err := mt.RootLogLen()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(len(roots)), n)
+
+	log, err := mt.Roots(0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, len(roots), len(log))
+	for i, e := range log {
+		assert.Equal(t, uint64(i), e.Seq)
+		assert.Equal(t, roots[i], e.Root)
+		assert.True(t, t0.Add(time.Duration(i)*time.Second).Equal(e.Time))
+	}
+	log, err = mt.Roots(2, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(log))
+	assert.Equal(t, roots[2], log[0].Root)
+	assert.Equal(t, roots[3], log[1].Root)
+
+	// The root at a time between two modifications is the previous one
+	root, err := mt.RootAt(t0.Add(3500 * time.Millisecond))
+	assert.Nil(t, err)
+	assert.Equal(t, roots[3], root.Root)
+	root, err = mt.RootAt(t0.Add(4 * time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, roots[4], root.Root)
+	root, err = mt.RootAt(t0.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, mt.RootKey(), root.Root)
+	_, err = mt.RootAt(t0.Add(-time.Second))
+	assert.Equal(t, ErrRootNotFound, err)
+
+	snapshot, err := mt.SnapshotAt(t0.Add(3 * time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, roots[3], snapshot.RootKey())
+	for i := 0; i < 4; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		proof, err := snapshot.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, i < 3, proof.Existence)
+	}
+}
+
+func TestRootLogClockBackwards(t *testing.T) {
+	t0 := time.Unix(1500000000, 0)
+	restore := setTimeNow(t0)
+	defer restore()
+
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	setTimeNow(t0.Add(-time.Hour))
+	e := NewEntryFromInts(0, 1, 0, 1)
+	assert.Nil(t, mt.Add(&e))
+
+	log, err := mt.Roots(0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(log))
+	assert.True(t, t0.Equal(log[1].Time))
+}
+
+func TestRootLogReopen(t *testing.T) {
+	sto := db.NewMemoryStorage()
+	mt, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	e := NewEntryFromInts(0, 1, 0, 1)
+	assert.Nil(t, mt.Add(&e))
+
+	mt2, err := NewMerkleTree(sto, 140)
+	assert.Nil(t, err)
+	e = NewEntryFromInts(0, 2, 0, 2)
+	assert.Nil(t, mt2.Add(&e))
+	n, err := mt2.RootLogLen()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), n)
+
+	// A failed modification is not logged
+	assert.Equal(t, ErrEntryIndexAlreadyExists, mt2.Add(&e))
+	n, err = mt2.RootLogLen()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), n)
+}
@@ -0,0 +1,390 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// EntryTypeLen is the length in bytes of the type of an Entry.
+const EntryTypeLen = 64 / 8
+
+var (
+	// statsValue is the Key used to store the statistics of the tree with
+	// the current Root in the database.
+	statsValue = []byte("stats")
+)
+
+// EntryType is the type of an Entry, stored in the last bytes of its last
+// element of Data.  For the claims of package core, it's the claim type.
+type EntryType [EntryTypeLen]byte
+
+// Type returns the type of the Entry.
+func (e *Entry) Type() EntryType {
+	var t EntryType
+	copy(t[:], e.Data[DataLen-1][ElemBytesLen-EntryTypeLen:])
+	return t
+}
+
+// Stats are the statistics of the tree with a root of a MT.
+type Stats struct {
+	// Root is the key of the root node of the tree.
+	Root *Hash
+	// Leafs is the number of leafs.
+	Leafs uint64
+	// Middles is the number of middle nodes.
+	Middles uint64
+	// MaxDepth is the depth of the deepest leaf, where the root is at
+	// depth 0.
+	MaxDepth int
+	// AvgDepth is the average depth of the leafs.
+	AvgDepth float64
+	// Types is the number of leafs of each EntryType.
+	Types map[EntryType]uint64
+}
+
+// treeStats are the counters from which the Stats of a tree are obtained.
+// They are signed so that they can also hold the difference between two
+// trees.
+type treeStats struct {
+	middles int64
+	// depths is the number of leafs at each depth.
+	depths map[int]int64
+	// types is the number of leafs of each EntryType.
+	types map[EntryType]int64
+}
+
+func newTreeStats() *treeStats {
+	return &treeStats{depths: make(map[int]int64), types: make(map[EntryType]int64)}
+}
+
+// addLeaf adds to the counters the leaf n found at depth.
+func (s *treeStats) addLeaf(n *Node, depth int) {
+	s.depths[depth]++
+	s.types[n.Entry.Type()]++
+}
+
+// add adds to s the counters of o multiplied by sign.
+func (s *treeStats) add(o *treeStats, sign int64) {
+	s.middles += sign * o.middles
+	for d, c := range o.depths {
+		if s.depths[d] += sign * c; s.depths[d] == 0 {
+			delete(s.depths, d)
+		}
+	}
+	for t, c := range o.types {
+		if s.types[t] += sign * c; s.types[t] == 0 {
+			delete(s.types, t)
+		}
+	}
+}
+
+// stats returns the Stats of the tree with root from its counters.
+func (s *treeStats) stats(root *Hash) *Stats {
+	st := &Stats{Root: root, Middles: uint64(s.middles), Types: make(map[EntryType]uint64)}
+	var sumDepths uint64
+	for d, c := range s.depths {
+		st.Leafs += uint64(c)
+		sumDepths += uint64(d) * uint64(c)
+		if d > st.MaxDepth {
+			st.MaxDepth = d
+		}
+	}
+	if st.Leafs > 0 {
+		st.AvgDepth = float64(sumDepths) / float64(st.Leafs)
+	}
+	for t, c := range s.types {
+		st.Types[t] = uint64(c)
+	}
+	return st
+}
+
+// bytes encodes the counters of the tree with root as: the root, the number of
+// middle nodes, the number of depths followed by each depth and its number of
+// leafs, and the number of types followed by each type and its number of
+// leafs.
+func (s *treeStats) bytes(root *Hash) []byte {
+	var b bytes.Buffer
+	b.Write(root[:])
+	binary.Write(&b, binary.BigEndian, uint64(s.middles))
+	depths := make([]int, 0, len(s.depths))
+	for d := range s.depths {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+	binary.Write(&b, binary.BigEndian, uint16(len(depths)))
+	for _, d := range depths {
+		binary.Write(&b, binary.BigEndian, uint16(d))
+		binary.Write(&b, binary.BigEndian, uint64(s.depths[d]))
+	}
+	types := make([]EntryType, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return bytes.Compare(types[i][:], types[j][:]) < 0 })
+	binary.Write(&b, binary.BigEndian, uint32(len(types)))
+	for _, t := range types {
+		b.Write(t[:])
+		binary.Write(&b, binary.BigEndian, uint64(s.types[t]))
+	}
+	return b.Bytes()
+}
+
+// parseTreeStats parses the counters encoded by treeStats.bytes, returning
+// them with the root of their tree.
+func parseTreeStats(b []byte) (*treeStats, *Hash, error) {
+	r := bytes.NewReader(b)
+	root := &Hash{}
+	var middles uint64
+	var numDepths uint16
+	if _, err := io.ReadFull(r, root[:]); err != nil {
+		return nil, nil, ErrInvalidDBValue
+	}
+	if err := binary.Read(r, binary.BigEndian, &middles); err != nil {
+		return nil, nil, ErrInvalidDBValue
+	}
+	s := newTreeStats()
+	s.middles = int64(middles)
+	if err := binary.Read(r, binary.BigEndian, &numDepths); err != nil {
+		return nil, nil, ErrInvalidDBValue
+	}
+	for i := 0; i < int(numDepths); i++ {
+		var depth struct {
+			Depth uint16
+			Leafs uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &depth); err != nil {
+			return nil, nil, ErrInvalidDBValue
+		}
+		s.depths[int(depth.Depth)] = int64(depth.Leafs)
+	}
+	var numTypes uint32
+	if err := binary.Read(r, binary.BigEndian, &numTypes); err != nil {
+		return nil, nil, ErrInvalidDBValue
+	}
+	for i := 0; i < int(numTypes); i++ {
+		var typ struct {
+			Type  EntryType
+			Leafs uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &typ); err != nil {
+			return nil, nil, ErrInvalidDBValue
+		}
+		s.types[typ.Type] = int64(typ.Leafs)
+	}
+	if r.Len() != 0 {
+		return nil, nil, ErrInvalidDBValue
+	}
+	return s, root, nil
+}
+
+// getNodeTx gets a node by key from the tx, which includes the nodes added in
+// it.
+func (mt *MerkleTree) getNodeTx(tx db.Tx, key *Hash) (*Node, error) {
+	if bytes.Equal(key[:], HashZero[:]) {
+		return NewNodeEmpty(), nil
+	}
+	nBytes, err := tx.Get(key[:])
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNodeFromBytes(nBytes)
+	if err != nil {
+		return nil, err
+	}
+	n.hasher = mt.hasher
+	return n, nil
+}
+
+// walkStats adds to s the counters of the whole tree with the given key at
+// depth lvl.
+func (mt *MerkleTree) walkStats(s *treeStats, key *Hash, lvl int) error {
+	n, err := mt.GetNode(key)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case NodeTypeEmpty:
+		return nil
+	case NodeTypeLeaf:
+		s.addLeaf(n, lvl)
+		return nil
+	case NodeTypeMiddle:
+		s.middles++
+		if err := mt.walkStats(s, n.ChildL, lvl+1); err != nil {
+			return err
+		}
+		return mt.walkStats(s, n.ChildR, lvl+1)
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// pathsStats adds to s the counters of the part of the tree with the given key
+// at depth lvl that can change when the entries with the given paths are
+// added, removed or updated: the nodes in the paths, and the leafs that hang
+// from them, which can be moved up or down.  The rest of the tree is made of
+// subtrees with at least two leafs that stay the same.
+func (mt *MerkleTree) pathsStats(getNode func(*Hash) (*Node, error), s *treeStats,
+	key *Hash, lvl int, paths [][]bool) error {
+	n, err := getNode(key)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case NodeTypeEmpty:
+		return nil
+	case NodeTypeLeaf:
+		s.addLeaf(n, lvl)
+		return nil
+	case NodeTypeMiddle:
+		if lvl >= mt.maxLevels-1 {
+			return ErrInvalidNodeFound
+		}
+		s.middles++
+		var pathsL, pathsR [][]bool
+		for _, path := range paths {
+			if path[lvl] {
+				pathsR = append(pathsR, path)
+			} else {
+				pathsL = append(pathsL, path)
+			}
+		}
+		for _, child := range []struct {
+			key   *Hash
+			paths [][]bool
+		}{{n.ChildL, pathsL}, {n.ChildR, pathsR}} {
+			if len(child.paths) > 0 {
+				if err := mt.pathsStats(getNode, s, child.key, lvl+1, child.paths); err != nil {
+					return err
+				}
+				continue
+			}
+			if bytes.Equal(child.key[:], HashZero[:]) {
+				continue
+			}
+			c, err := getNode(child.key)
+			if err != nil {
+				return err
+			}
+			if c.Type == NodeTypeLeaf {
+				s.addLeaf(c, lvl+1)
+			}
+		}
+		return nil
+	default:
+		return ErrInvalidNodeFound
+	}
+}
+
+// storedStats returns the counters stored for the tree with root, or nil if
+// they are not stored (they are from another root, or the MT was created
+// before they were maintained).
+func (mt *MerkleTree) storedStats(v []byte, err error, root *Hash) (*treeStats, error) {
+	if err == db.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(v) < 1 || NodeType(v[0]) != DBEntryTypeStats {
+		return nil, ErrInvalidDBValue
+	}
+	s, statsRoot, err := parseTreeStats(v[1:])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(statsRoot[:], root[:]) {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// updateStats updates in the tx the stored counters of the tree with oldRoot
+// to the counters of the tree with newRoot, which differs from it in the
+// entries with hIndexes.  The new nodes are read from the tx.  The counters of
+// a new MT are stored when it's created.  If the counters of the tree with
+// oldRoot are not stored (the MT was created before they were maintained),
+// nothing is done, so that the whole tree is not walked while
+// the MT is being modified; they are calculated by the next call to Stats.
+func (mt *MerkleTree) updateStats(tx db.Tx, oldRoot, newRoot *Hash, hIndexes []*Hash) error {
+	v, err := tx.Get(statsValue)
+	s, err := mt.storedStats(v, err, oldRoot)
+	if err != nil || s == nil {
+		return err
+	}
+	paths := make([][]bool, len(hIndexes))
+	for i, hIndex := range hIndexes {
+		paths[i] = getPath(mt.maxLevels, hIndex)
+	}
+	oldPaths := newTreeStats()
+	if err := mt.pathsStats(mt.GetNode, oldPaths, oldRoot, 0, paths); err != nil {
+		return err
+	}
+	newPaths := newTreeStats()
+	getNode := func(key *Hash) (*Node, error) { return mt.getNodeTx(tx, key) }
+	if err := mt.pathsStats(getNode, newPaths, newRoot, 0, paths); err != nil {
+		return err
+	}
+	s.add(oldPaths, -1)
+	s.add(newPaths, 1)
+	mt.dbInsert(tx, statsValue, DBEntryTypeStats, s.bytes(newRoot))
+	return nil
+}
+
+// Stats returns the statistics of the tree with the current root of the MT.
+// They are stored when the MT is created and maintained in the storage as the
+// tree is modified, so they are only calculated by walking the whole tree the
+// first time for MTs created before they were maintained, or for a Snapshot of a past root.  In the first
+// case they are stored, holding the lock of the MT meanwhile, and from then on
+// they are maintained.
+func (mt *MerkleTree) Stats() (*Stats, error) {
+	mt.RLock()
+	rootKey := mt.rootKey
+	s, err := mt.currentStats()
+	mt.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		return s.stats(rootKey), nil
+	}
+	if !mt.writable {
+		s = newTreeStats()
+		if err := mt.walkStats(s, rootKey, 0); err != nil {
+			return nil, err
+		}
+		return s.stats(rootKey), nil
+	}
+
+	mt.Lock()
+	defer mt.Unlock()
+	// The stats may have been stored while the MT was unlocked
+	if s, err = mt.currentStats(); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		s = newTreeStats()
+		if err := mt.walkStats(s, mt.rootKey, 0); err != nil {
+			return nil, err
+		}
+		tx, err := mt.storage.NewTx()
+		if err != nil {
+			return nil, err
+		}
+		mt.dbInsert(tx, statsValue, DBEntryTypeStats, s.bytes(mt.rootKey))
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return s.stats(mt.rootKey), nil
+}
+
+// currentStats returns the counters stored for the tree with the current root,
+// or nil if they are not stored.
+func (mt *MerkleTree) currentStats() (*treeStats, error) {
+	v, err := mt.storage.Get(statsValue)
+	return mt.storedStats(v, err, mt.rootKey)
+}
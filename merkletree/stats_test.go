@@ -0,0 +1,188 @@
+package merkletree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// walkedStats returns the Stats of the tree with root calculated by walking
+// the whole tree.
+func walkedStats(t *testing.T, mt *MerkleTree, root *Hash) *Stats {
+	s := newTreeStats()
+	assert.Nil(t, mt.walkStats(s, root, 0))
+	return s.stats(root)
+}
+
+// newTestingStatsEntry returns an entry of type i%3.
+func newTestingStatsEntry(i int64) Entry {
+	return NewEntryFromInts(0, i, i, i%3)
+}
+
+func TestStats(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	stats, err := mt.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, &Stats{Root: &HashZero, Types: map[EntryType]uint64{}}, stats)
+
+	for i := int64(0); i < 64; i++ {
+		e := newTestingStatsEntry(i)
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+		stats, err = mt.Stats()
+		assert.Nil(t, err)
+		assert.Equal(t, walkedStats(t, mt, mt.RootKey()), stats)
+	}
+	assert.Equal(t, uint64(64), stats.Leafs)
+	e := newTestingStatsEntry(1)
+	assert.Equal(t, uint64(21), stats.Types[e.Type()])
+
+	var nodes, leafs uint64
+	err = mt.Walk(nil, func(n *Node) {
+		switch n.Type {
+		case NodeTypeLeaf:
+			leafs++
+		case NodeTypeMiddle:
+			nodes++
+		}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, leafs, stats.Leafs)
+	assert.Equal(t, nodes, stats.Middles)
+
+	for i := int64(0); i < 64; i += 3 {
+		e := newTestingStatsEntry(i)
+		assert.Nil(t, mt.Delete(e.HIndex()))
+		stats, err := mt.Stats()
+		assert.Nil(t, err)
+		assert.Equal(t, walkedStats(t, mt, mt.RootKey()), stats)
+	}
+	for i := int64(1); i < 64; i += 3 {
+		e := NewEntryFromInts(1000+i, i, i, i%3) // same hIndex, new hValue
+		_, _, err := mt.Update(&e)
+		assert.Nil(t, err)
+		stats, err := mt.Stats()
+		assert.Nil(t, err)
+		assert.Equal(t, walkedStats(t, mt, mt.RootKey()), stats)
+	}
+
+	// Delete all the remaining entries
+	for i := int64(1); i < 64; i++ {
+		if i%3 == 0 {
+			continue
+		}
+		e := newTestingStatsEntry(i)
+		assert.Nil(t, mt.Delete(e.HIndex()))
+	}
+	stats, err = mt.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, &Stats{Root: &HashZero, Types: map[EntryType]uint64{}}, stats)
+}
+
+func TestStatsNewTree(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	s, err := mt.currentStats()
+	assert.Nil(t, err)
+	assert.Equal(t, &Stats{Root: &HashZero, Types: map[EntryType]uint64{}}, s.stats(mt.RootKey()))
+
+	// The stored Stats are maintained from the creation of the MT, without
+	// calling Stats
+	for i := int64(0); i < 32; i++ {
+		e := newTestingStatsEntry(i)
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = mt.currentStats()
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, walkedStats(t, mt, mt.RootKey()), s.stats(mt.RootKey()))
+	assert.Equal(t, uint64(32), s.stats(mt.RootKey()).Leafs)
+}
+
+func TestStatsBatch(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	var entries []*Entry
+	for i := int64(0); i < 100; i++ {
+		e := newTestingStatsEntry(i)
+		entries = append(entries, &e)
+	}
+	assert.Nil(t, mt.AddBatch(entries[:10]))
+	assert.Nil(t, mt.AddBatch(entries[10:]))
+	stats, err := mt.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, walkedStats(t, mt, mt.RootKey()), stats)
+	assert.Equal(t, uint64(100), stats.Leafs)
+
+	var dump bytes.Buffer
+	assert.Nil(t, mt.DumpBinary(&dump, nil))
+	mt2 := newTestingMerkle(t, 140)
+	defer mt2.Storage().Close()
+	_, err = mt2.ImportBinary(&dump)
+	assert.Nil(t, err)
+	stats2, err := mt2.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, stats2)
+}
+
+func TestStatsNotStored(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := int64(0); i < 16; i++ {
+		e := newTestingStatsEntry(i)
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root16 := mt.RootKey()
+
+	// A MT created before the Stats were maintained
+	tx, err := mt.Storage().NewTx()
+	assert.Nil(t, err)
+	tx.Delete(statsValue)
+	assert.Nil(t, tx.Commit())
+
+	e := newTestingStatsEntry(16)
+	assert.Nil(t, mt.Add(&e))
+	// Add doesn't calculate the missing Stats
+	_, err = mt.Storage().Get(statsValue)
+	assert.Equal(t, db.ErrNotFound, err)
+	stats, err := mt.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, walkedStats(t, mt, mt.RootKey()), stats)
+	assert.Equal(t, uint64(17), stats.Leafs)
+	// From then on they are maintained
+	e = newTestingStatsEntry(17)
+	assert.Nil(t, mt.Add(&e))
+	s, err := mt.currentStats()
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, walkedStats(t, mt, mt.RootKey()), s.stats(mt.RootKey()))
+
+	// The Stats of a past root are calculated
+	snapshot, err := mt.Snapshot(root16)
+	assert.Nil(t, err)
+	stats, err = snapshot.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, walkedStats(t, mt, root16), stats)
+	assert.Equal(t, uint64(16), stats.Leafs)
+	stats, err = mt.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(18), stats.Leafs)
+
+	// An invalid stored value
+	tx, err = mt.Storage().NewTx()
+	assert.Nil(t, err)
+	tx.Put(statsValue, []byte{byte(DBEntryTypeStats), 1, 2})
+	assert.Nil(t, tx.Commit())
+	_, err = mt.Stats()
+	assert.Equal(t, ErrInvalidDBValue, err)
+}
@@ -0,0 +1,279 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/iden3/go-iden3-core/db"
+)
+
+// syncMaxNodesPerRequest is the maximum number of nodes that are requested at
+// once to a NodeSource.
+const syncMaxNodesPerRequest = 1024
+
+var (
+	// ErrSyncNodeMismatch is used when a node received from a NodeSource
+	// doesn't match the key it was requested with.
+	ErrSyncNodeMismatch = errors.New("the synced node doesn't match its key")
+	// ErrSyncNodeNotFound is used when a NodeSource doesn't return a node
+	// it was requested.
+	ErrSyncNodeNotFound = errors.New("the node source didn't return a requested node")
+	// ErrSyncTooManyNodes is used when more nodes than
+	// syncMaxNodesPerRequest are requested at once through a stream.
+	ErrSyncTooManyNodes = errors.New("too many nodes requested at once")
+	// ErrSyncInvalidResponse is used when the response received through a
+	// stream is malformed.
+	ErrSyncInvalidResponse = errors.New("invalid sync response")
+)
+
+// NodeSource is a source of nodes of a MT from which the nodes can be
+// replicated.
+type NodeSource interface {
+	// GetNodes returns the nodes with the given keys, in the same order.
+	GetNodes(keys []*Hash) ([]*Node, error)
+}
+
+// GetNodes gets the nodes with the given keys from the MT.  This allows a
+// MerkleTree to be used as the NodeSource of a Sync.
+func (mt *MerkleTree) GetNodes(keys []*Hash) ([]*Node, error) {
+	nodes := make([]*Node, len(keys))
+	for i, key := range keys {
+		n, err := mt.GetNode(key)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// syncNode verifies that the node received from a NodeSource has the
+// requested key using the hash function of the MT, and adds it to the MT.
+func (mt *MerkleTree) syncNode(tx db.Tx, key *Hash, n *Node) (*Node, error) {
+	if n == nil {
+		return nil, ErrSyncNodeNotFound
+	}
+	// Parse the node again so that its key is calculated here, instead of
+	// trusting a key cached by the source.
+	n, err := NewNodeFromBytes(n.Value())
+	if err != nil {
+		return nil, err
+	}
+	if n.Type == NodeTypeEmpty {
+		return nil, ErrSyncNodeMismatch
+	}
+	n.hasher = mt.hasher
+	if !bytes.Equal(n.Key()[:], key[:]) {
+		return nil, ErrSyncNodeMismatch
+	}
+	if _, err := mt.addNode(tx, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Sync replicates into the storage of the MT all the nodes of the tree with
+// the given rootKey that are missing, getting them from src, and returns the
+// number of nodes added.  The subtrees whose root is already in the storage
+// are not requested.  All the nodes are added in a single transaction, so
+// that the storage never contains an incomplete subtree.  The current root of
+// the MT is not modified; the replicated tree can be used with
+// Snapshot(rootKey).
+func (mt *MerkleTree) Sync(src NodeSource, rootKey *Hash) (int, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return 0, ErrNotWritable
+	}
+	tx, err := mt.storage.NewTx()
+	if err != nil {
+		return 0, err
+	}
+	added, err := mt.syncNodes(tx, src, rootKey)
+	if err != nil {
+		tx.Close()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// syncNodes adds to tx the missing nodes of the tree with the given rootKey.
+func (mt *MerkleTree) syncNodes(tx db.Tx, src NodeSource, rootKey *Hash) (int, error) {
+	added := 0
+	// The tree is traversed one level at a time, requesting together all
+	// the missing nodes of the level.
+	pending := []*Hash{rootKey}
+	for len(pending) > 0 {
+		var missing []*Hash
+		for _, key := range pending {
+			if bytes.Equal(key[:], HashZero[:]) {
+				continue
+			}
+			if _, err := tx.Get(key[:]); err == nil {
+				continue
+			}
+			missing = append(missing, key)
+		}
+		pending = nil
+		for len(missing) > 0 {
+			keys := missing
+			if len(keys) > syncMaxNodesPerRequest {
+				keys = keys[:syncMaxNodesPerRequest]
+			}
+			missing = missing[len(keys):]
+			nodes, err := src.GetNodes(keys)
+			if err != nil {
+				return 0, err
+			}
+			if len(nodes) != len(keys) {
+				return 0, ErrSyncInvalidResponse
+			}
+			for i, key := range keys {
+				n, err := mt.syncNode(tx, key, nodes[i])
+				if err != nil {
+					return 0, err
+				}
+				added++
+				if n.Type == NodeTypeMiddle {
+					pending = append(pending, n.ChildL, n.ChildR)
+				}
+			}
+		}
+	}
+	return added, nil
+}
+
+// hasNilNode returns true if any of the nodes is nil.
+func hasNilNode(nodes []*Node) bool {
+	for _, n := range nodes {
+		if n == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeNodes reads the requests of a StreamNodeSource from r and writes the
+// responses with the nodes of src to w, until r is closed.
+//
+// A request consists of the number of nodes as a big endian uint32 followed
+// by their keys.  The response starts with a byte that is 0 if all the nodes
+// have been found, followed by each node value prefixed by its length as a
+// big endian uint32, or 1 otherwise.
+func ServeNodes(src NodeSource, r io.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for {
+		var count uint32
+		if err := binary.Read(r, binary.BigEndian, &count); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if count > syncMaxNodesPerRequest {
+			return ErrSyncTooManyNodes
+		}
+		keys := make([]*Hash, count)
+		for i := range keys {
+			keys[i] = &Hash{}
+			if _, err := io.ReadFull(r, keys[i][:]); err != nil {
+				return err
+			}
+		}
+		nodes, err := src.GetNodes(keys)
+		if err == nil && hasNilNode(nodes) {
+			err = db.ErrNotFound
+		}
+		if err == db.ErrNotFound {
+			if err := bw.WriteByte(1); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			if err := bw.WriteByte(0); err != nil {
+				return err
+			}
+			for _, n := range nodes {
+				v := n.Value()
+				if err := binary.Write(bw, binary.BigEndian, uint32(len(v))); err != nil {
+					return err
+				}
+				if _, err := bw.Write(v); err != nil {
+					return err
+				}
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamNodeSource is a NodeSource that requests the nodes to a ServeNodes
+// running at the other end of a stream.
+type StreamNodeSource struct {
+	r io.Reader
+	w *bufio.Writer
+}
+
+// NewStreamNodeSource creates a StreamNodeSource that writes the requests to
+// w and reads the responses from r.
+func NewStreamNodeSource(r io.Reader, w io.Writer) *StreamNodeSource {
+	return &StreamNodeSource{r: r, w: bufio.NewWriter(w)}
+}
+
+// GetNodes requests the nodes with the given keys through the stream.  If any
+// of the nodes is not found, db.ErrNotFound is returned.
+func (s *StreamNodeSource) GetNodes(keys []*Hash) ([]*Node, error) {
+	if len(keys) > syncMaxNodesPerRequest {
+		return nil, ErrSyncTooManyNodes
+	}
+	if err := binary.Write(s.w, binary.BigEndian, uint32(len(keys))); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, err := s.w.Write(key[:]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(s.r, status[:]); err != nil {
+		return nil, err
+	}
+	switch status[0] {
+	case 0:
+	case 1:
+		return nil, db.ErrNotFound
+	default:
+		return nil, ErrSyncInvalidResponse
+	}
+	nodes := make([]*Node, len(keys))
+	for i := range nodes {
+		var length uint32
+		if err := binary.Read(s.r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		if length > 1+DataLen*ElemBytesLen {
+			return nil, ErrSyncInvalidResponse
+		}
+		v := make([]byte, length)
+		if _, err := io.ReadFull(s.r, v); err != nil {
+			return nil, err
+		}
+		n, err := NewNodeFromBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
@@ -0,0 +1,167 @@
+package merkletree
+
+import (
+	"io"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func checkReplica(t *testing.T, replica *MerkleTree, rootKey *Hash, from, to int) {
+	snapshot, err := replica.Snapshot(rootKey)
+	assert.Nil(t, err)
+	for i := from; i < to; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		proof, err := snapshot.GenerateProof(e.HIndex(), nil)
+		assert.Nil(t, err)
+		assert.True(t, proof.Existence)
+		assert.True(t, VerifyProof(rootKey, proof, e.HIndex(), e.HValue()))
+	}
+}
+
+func TestSync(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 64; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root1 := mt.RootKey()
+
+	replica := newTestingMerkle(t, 140)
+	defer replica.Storage().Close()
+	added, err := replica.Sync(mt, root1)
+	assert.Nil(t, err)
+	assert.Equal(t, countReachableNodes(t, mt, root1), added)
+	assert.Equal(t, added, countStoredNodes(t, replica))
+	checkReplica(t, replica, root1, 0, 64)
+
+	// The current root of the replica is not modified
+	assert.Equal(t, HashZero, *replica.RootKey())
+
+	// Syncing again doesn't add anything
+	added, err = replica.Sync(mt, root1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, added)
+
+	// Only the new nodes are added when syncing a new root
+	e := NewEntryFromInts(0, 64, 0, 64)
+	assert.Nil(t, mt.Add(&e))
+	root2 := mt.RootKey()
+	added, err = replica.Sync(mt, root2)
+	assert.Nil(t, err)
+	assert.Equal(t, countReachableNodes(t, mt, root1, root2)-countReachableNodes(t, mt, root1), added)
+	checkReplica(t, replica, root2, 0, 65)
+}
+
+func TestSyncStream(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 32; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- ServeNodes(mt, reqR, respW)
+	}()
+
+	replica := newTestingMerkle(t, 140)
+	defer replica.Storage().Close()
+	src := NewStreamNodeSource(respR, reqW)
+	added, err := replica.Sync(src, mt.RootKey())
+	assert.Nil(t, err)
+	assert.Equal(t, countReachableNodes(t, mt, mt.RootKey()), added)
+	checkReplica(t, replica, mt.RootKey(), 0, 32)
+
+	// A node that doesn't exist in the source
+	_, err = replica.Sync(src, &Hash{1})
+	assert.Equal(t, db.ErrNotFound, err)
+
+	reqW.Close()
+	assert.Nil(t, <-done)
+}
+
+// corruptNodeSource returns the leafs of a MT with a modified entry.
+type corruptNodeSource struct {
+	mt *MerkleTree
+}
+
+func (s corruptNodeSource) GetNodes(keys []*Hash) ([]*Node, error) {
+	nodes, err := s.mt.GetNodes(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range nodes {
+		if n.Type == NodeTypeLeaf {
+			nodes[i] = NewNodeLeaf(&Entry{Data: IntsToData(1, 2, 3, 4)})
+		}
+	}
+	return nodes, nil
+}
+
+// nilNodeSource returns nil instead of the middle nodes of a MT.
+type nilNodeSource struct {
+	mt *MerkleTree
+}
+
+func (s nilNodeSource) GetNodes(keys []*Hash) ([]*Node, error) {
+	nodes, err := s.mt.GetNodes(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range nodes {
+		if n.Type == NodeTypeMiddle {
+			nodes[i] = nil
+		}
+	}
+	return nodes, nil
+}
+
+func TestSyncInvalidNode(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 8; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replica := newTestingMerkle(t, 140)
+	defer replica.Storage().Close()
+	_, err := replica.Sync(corruptNodeSource{mt}, mt.RootKey())
+	assert.Equal(t, ErrSyncNodeMismatch, err)
+	// Nothing has been added to the replica
+	assert.Equal(t, 0, countStoredNodes(t, replica))
+
+	// A source that returns nil nodes
+	_, err = replica.Sync(nilNodeSource{mt}, mt.RootKey())
+	assert.Equal(t, ErrSyncNodeNotFound, err)
+	assert.Equal(t, 0, countStoredNodes(t, replica))
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- ServeNodes(nilNodeSource{mt}, reqR, respW)
+		respW.Close()
+	}()
+	_, err = replica.Sync(NewStreamNodeSource(respR, reqW), mt.RootKey())
+	assert.Equal(t, db.ErrNotFound, err)
+	reqW.Close()
+	assert.Nil(t, <-done)
+
+	// The replica must use the same hash function
+	replicaMimc7, err := NewMerkleTreeHash(db.NewMemoryStorage(), 140, HashKindMimc7)
+	assert.Nil(t, err)
+	_, err = replicaMimc7.Sync(mt, mt.RootKey())
+	assert.Equal(t, ErrSyncNodeMismatch, err)
+}
@@ -0,0 +1,167 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// TransitionWitness contains the elements required to verify the transition
+// of a MT from an old root to a new root by the insertion of a single entry,
+// with the same inputs as the smtprocessor circuit of circomlib for an
+// insertion.  The siblings are padded with zeros to the maxLevels of the MT.
+type TransitionWitness struct {
+	// OldRoot and NewRoot are the roots of the MT before and after the
+	// insertion.
+	OldRoot *Hash
+	NewRoot *Hash
+	// Siblings are all the siblings of the path of the entry in the tree
+	// with OldRoot, including the empty ones, from the root to the leaf.
+	Siblings []*Hash
+	// OldKey and OldValue are the hIndex and hValue of the leaf displaced
+	// by the entry, if any.
+	OldKey   *Hash
+	OldValue *Hash
+	// IsOld0 indicates that the path of the entry ends in an empty node in
+	// the tree with OldRoot, so no leaf is displaced.
+	IsOld0 bool
+	// Key and Value are the hIndex and hValue of the inserted entry.
+	Key   *Hash
+	Value *Hash
+	// HashKind is the kind of hash function of the MT.
+	HashKind HashKind
+}
+
+// newTransitionWitness creates the TransitionWitness of the insertion of the
+// entry with hIndex and hValue, given its proof of non-existence in the tree
+// with oldRoot.
+func (mt *MerkleTree) newTransitionWitness(proof *Proof, oldRoot, newRoot, hIndex, hValue *Hash) *TransitionWitness {
+	siblings := proof.AllSiblings()
+	for len(siblings) < mt.maxLevels {
+		siblings = append(siblings, &HashZero)
+	}
+	w := &TransitionWitness{
+		OldRoot:  oldRoot,
+		NewRoot:  newRoot,
+		Siblings: siblings,
+		OldKey:   &HashZero,
+		OldValue: &HashZero,
+		IsOld0:   proof.nodeAux == nil,
+		Key:      hIndex,
+		Value:    hValue,
+		HashKind: mt.hasher.Kind(),
+	}
+	if proof.nodeAux != nil {
+		w.OldKey = proof.nodeAux.hIndex
+		w.OldValue = proof.nodeAux.hValue
+	}
+	return w
+}
+
+// AddWithWitness adds the Entry to the MerkleTree like Add, and returns the
+// TransitionWitness of the insertion.
+func (mt *MerkleTree) AddWithWitness(e *Entry) (*TransitionWitness, error) {
+	return mt.add(e, true)
+}
+
+// rootFromSiblings computes the root from the key of the node at the end of
+// the path of hIndex and the siblings along the path.
+func rootFromSiblings(hasher Hasher, key *Hash, hIndex *Hash, siblings []*Hash) *Hash {
+	for lvl := len(siblings) - 1; lvl >= 0; lvl-- {
+		if testBitBigEndian(hIndex[:], uint(lvl)) {
+			key = newNodeMiddleHasher(hasher, siblings[lvl], key).Key()
+		} else {
+			key = newNodeMiddleHasher(hasher, key, siblings[lvl]).Key()
+		}
+	}
+	return key
+}
+
+// VerifyTransition verifies that the tree with the NewRoot of the
+// TransitionWitness is the tree with the OldRoot where the entry with Key and
+// Value has been inserted, and nothing else has changed.  Both roots are
+// recomputed from the witness without accessing the storage.
+func VerifyTransition(w *TransitionWitness) bool {
+	hasher, err := w.HashKind.Hasher()
+	if err != nil {
+		return false
+	}
+	// The path ends below the last non-empty sibling: a middle node with
+	// an empty child has at least two leafs below the other one.
+	depth := len(w.Siblings)
+	for depth > 0 && bytes.Equal(w.Siblings[depth-1][:], HashZero[:]) {
+		depth--
+	}
+	siblings := w.Siblings[:depth]
+	newLeafKey := leafKeyHasher(hasher, w.Key, w.Value)
+
+	var oldKey, newKey *Hash
+	if w.IsOld0 {
+		oldKey = &HashZero
+		newKey = newLeafKey
+	} else {
+		if bytes.Equal(w.OldKey[:], w.Key[:]) {
+			return false
+		}
+		// The displaced leaf must be in the path of the entry, and
+		// both are pushed down until their paths diverge.
+		lvl := 0
+		for ; lvl < len(w.Siblings)-1; lvl++ {
+			if testBitBigEndian(w.OldKey[:], uint(lvl)) != testBitBigEndian(w.Key[:], uint(lvl)) {
+				break
+			}
+		}
+		if lvl < depth || lvl >= len(w.Siblings)-1 {
+			return false
+		}
+		oldKey = leafKeyHasher(hasher, w.OldKey, w.OldValue)
+		if testBitBigEndian(w.Key[:], uint(lvl)) {
+			newKey = newNodeMiddleHasher(hasher, oldKey, newLeafKey).Key()
+		} else {
+			newKey = newNodeMiddleHasher(hasher, newLeafKey, oldKey).Key()
+		}
+		for lvl--; lvl >= depth; lvl-- {
+			if testBitBigEndian(w.Key[:], uint(lvl)) {
+				newKey = newNodeMiddleHasher(hasher, &HashZero, newKey).Key()
+			} else {
+				newKey = newNodeMiddleHasher(hasher, newKey, &HashZero).Key()
+			}
+		}
+	}
+	oldRoot := rootFromSiblings(hasher, oldKey, w.Key, siblings)
+	newRoot := rootFromSiblings(hasher, newKey, w.Key, siblings)
+	return bytes.Equal(oldRoot[:], w.OldRoot[:]) && bytes.Equal(newRoot[:], w.NewRoot[:])
+}
+
+// transitionWitnessJSON is the circom input JSON of a TransitionWitness,
+// where all the values are field elements in decimal.
+type transitionWitnessJSON struct {
+	OldRoot  string    `json:"oldRoot"`
+	NewRoot  string    `json:"newRoot"`
+	Siblings []string  `json:"siblings"`
+	OldKey   string    `json:"oldKey"`
+	OldValue string    `json:"oldValue"`
+	IsOld0   string    `json:"isOld0"`
+	NewKey   string    `json:"newKey"`
+	NewValue string    `json:"newValue"`
+	Fnc      [2]string `json:"fnc"`
+}
+
+// MarshalJSON encodes the TransitionWitness as a circom input JSON, where fnc
+// is the one of an insertion.
+func (w *TransitionWitness) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(w.Siblings))
+	for i, sib := range w.Siblings {
+		siblings[i] = sib.BigInt().String()
+	}
+	return json.Marshal(transitionWitnessJSON{
+		OldRoot:  w.OldRoot.BigInt().String(),
+		NewRoot:  w.NewRoot.BigInt().String(),
+		Siblings: siblings,
+		OldKey:   w.OldKey.BigInt().String(),
+		OldValue: w.OldValue.BigInt().String(),
+		IsOld0:   boolToDecimal(w.IsOld0),
+		NewKey:   w.Key.BigInt().String(),
+		NewValue: w.Value.BigInt().String(),
+		Fnc:      [2]string{"1", "0"},
+	})
+}
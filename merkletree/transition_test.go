@@ -0,0 +1,107 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/iden3/go-iden3-core/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddWithWitness(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+
+	displaced := 0
+	for i := 0; i < 64; i++ {
+		oldRoot := mt.RootKey()
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		w, err := mt.AddWithWitness(&e)
+		assert.Nil(t, err)
+		assert.Equal(t, oldRoot, w.OldRoot)
+		assert.Equal(t, mt.RootKey(), w.NewRoot)
+		assert.Equal(t, e.HIndex(), w.Key)
+		assert.Equal(t, e.HValue(), w.Value)
+		assert.Equal(t, 140, len(w.Siblings))
+		assert.True(t, VerifyTransition(w))
+		if !w.IsOld0 {
+			displaced++
+		}
+	}
+	assert.NotEqual(t, 0, displaced)
+
+	// The same entry can't be added twice
+	root := mt.RootKey()
+	e := NewEntryFromInts(0, 3, 0, 3)
+	_, err := mt.AddWithWitness(&e)
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	assert.Equal(t, root, mt.RootKey())
+}
+
+func TestVerifyTransitionInvalid(t *testing.T) {
+	mt := newTestingMerkle(t, 140)
+	defer mt.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		if err := mt.Add(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var w *TransitionWitness
+	for i := 16; w == nil || w.IsOld0; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		var err error
+		w, err = mt.AddWithWitness(&e)
+		assert.Nil(t, err)
+	}
+	assert.True(t, VerifyTransition(w))
+
+	modify := func(f func(w *TransitionWitness)) *TransitionWitness {
+		wm := *w
+		wm.Siblings = append([]*Hash{}, w.Siblings...)
+		f(&wm)
+		return &wm
+	}
+	other := NewEntryFromInts(0, 1000, 0, 1000)
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.Value = other.HValue() })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.Key = other.HIndex() })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.OldValue = other.HValue() })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.OldKey = w.Key })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.IsOld0 = true })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.OldRoot = w.NewRoot })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.Siblings[0] = other.HIndex() })))
+	assert.False(t, VerifyTransition(modify(func(w *TransitionWitness) { w.HashKind = HashKindMimc7 })))
+}
+
+func TestAddWithWitnessMimc7(t *testing.T) {
+	mt, err := NewMerkleTreeHash(db.NewMemoryStorage(), 40, HashKindMimc7)
+	assert.Nil(t, err)
+	defer mt.Storage().Close()
+	for i := 0; i < 16; i++ {
+		e := NewEntryFromInts(0, int64(i), 0, int64(i))
+		w, err := mt.AddWithWitness(&e)
+		assert.Nil(t, err)
+		assert.Equal(t, HashKindMimc7, w.HashKind)
+		assert.True(t, VerifyTransition(w))
+	}
+}
+
+func TestTransitionWitnessJSON(t *testing.T) {
+	mt := newTestingMerkle(t, 10)
+	defer mt.Storage().Close()
+	e := NewEntryFromInts(0, 1, 0, 1)
+	w, err := mt.AddWithWitness(&e)
+	assert.Nil(t, err)
+
+	wJSON, err := json.Marshal(w)
+	assert.Nil(t, err)
+	var inputs map[string]interface{}
+	assert.Nil(t, json.Unmarshal(wJSON, &inputs))
+	assert.Equal(t, "0", inputs["oldRoot"])
+	assert.Equal(t, mt.RootKey().BigInt().String(), inputs["newRoot"])
+	assert.Equal(t, e.HIndex().BigInt().String(), inputs["newKey"])
+	assert.Equal(t, e.HValue().BigInt().String(), inputs["newValue"])
+	assert.Equal(t, "1", inputs["isOld0"])
+	assert.Equal(t, []interface{}{"1", "0"}, inputs["fnc"])
+	assert.Equal(t, 10, len(inputs["siblings"].([]interface{})))
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	common3 "github.com/iden3/go-iden3-core/common"
-	"github.com/iden3/go-iden3-crypto/poseidon"
 )
 
 // Hash is the type used to represent a hash used in the MT.
@@ -30,6 +29,11 @@ func (h Hash) Bytes() []byte {
 	return h[:]
 }
 
+// BigInt returns the Hash as a *big.Int.
+func (h *Hash) BigInt() *big.Int {
+	return ElemBytesToBigInt(ElemBytes(*h))
+}
+
 func (h *Hash) MarshalText() ([]byte, error) {
 	return []byte(common3.HexEncode(h.Bytes())), nil
 }
@@ -57,31 +61,16 @@ func BigIntToHash(e *big.Int) (h Hash) {
 	return h
 }
 
-// HashElems performs a mimc7 hash over the array of ElemBytes.
+// HashElems performs a hash over the array of ElemBytes with the default hash
+// function (Poseidon).
 func HashElems(elems ...ElemBytes) *Hash {
-	bigints := ElemBytesToBigInts(elems...)
-	// mimcHash, err := mimc7.Hash(bigints, nil)
-	poseidonHash, err := poseidon.Hash(bigints)
-	if err != nil {
-		panic(err)
-	}
-	h := BigIntToHash(poseidonHash)
-	return &h
+	return HasherPoseidon.HashElems(elems...)
 }
 
-// HashElemsKey performs a mimc7 hash over the array of ElemBytes.
+// HashElemsKey performs a hash over the array of ElemBytes with a key, using the
+// default hash function (Poseidon).
 func HashElemsKey(key *big.Int, elems ...ElemBytes) *Hash {
-	bigints := ElemBytesToBigInts(elems...)
-	// mimcHash, err := mimc7.Hash(bigints, key)
-	if key != nil {
-		bigints = append([]*big.Int{key}, bigints...)
-	}
-	poseidonHash, err := poseidon.Hash(bigints)
-	if err != nil {
-		panic(err)
-	}
-	h := BigIntToHash(poseidonHash)
-	return &h
+	return HasherPoseidon.HashElemsKey(key, elems...)
 }
 
 // getPath returns the binary path, from the root to the leaf.
@@ -50,18 +50,17 @@ func main() {
 		panic(err)
 	}
 
-	mp, err := mt.GenerateProof(claimEntry0.HIndex(), nil)
+	mp, err := mt.GenerateProof(mt.HIndex(claimEntry0), nil)
 	if err != nil {
 		panic(err)
 	}
 	fmt.Println("merkle root: " + mt.RootKey().Hex())
 
 	fmt.Println("merkle proof: ", mp)
-	checked := merkletree.VerifyProof(mt.RootKey(), mp,
-		claimEntry0.HIndex(), claimEntry0.HValue())
+	checked := merkletree.VerifyProofEntry(mt.RootKey(), mp, claimEntry0)
 	fmt.Println("merkle proof checked:", checked)
 
-	claimDataInPos, err := mt.GetDataByIndex(claimEntry0.HIndex())
+	claimDataInPos, err := mt.GetDataByIndex(mt.HIndex(claimEntry0))
 	if err != nil {
 		panic(err)
 	}
@@ -78,14 +77,14 @@ func main() {
 	claim2 := core.NewClaimAssignName(name2, id2)
 	claimEntry2 := claim2.Entry()
 
-	mp, err = mt.GenerateProof(claimEntry2.HIndex(), nil)
+	mp, err = mt.GenerateProof(mt.HIndex(claimEntry2), nil)
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Println("merkle proof: ", mp)
 
-	checked = merkletree.VerifyProof(mt.RootKey(), mp, claimEntry2.HIndex(), claimEntry2.HValue())
+	checked = merkletree.VerifyProofEntry(mt.RootKey(), mp, claimEntry2)
 
 	fmt.Println("merkle proof of non existence checked:", checked)
 
@@ -3,6 +3,8 @@ package adminsrv
 import (
 	"fmt"
 	"math/big"
+	"net/http"
+	"strconv"
 
 	// "github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
@@ -14,11 +16,25 @@ import (
 	"github.com/iden3/go-iden3-crypto/mimc7"
 )
 
+const (
+	// ClaimsPageDefaultLimit is the number of claims of a page of
+	// ClaimsPageHandler when no limit is given.
+	ClaimsPageDefaultLimit = 100
+	// ClaimsPageMaxLimit is the maximum number of claims of a page.
+	ClaimsPageMaxLimit = 1000
+)
+
+// ErrInvalidLimit is used when the limit of a page of claims is not between 1
+// and ClaimsPageMaxLimit.
+var ErrInvalidLimit = fmt.Errorf("the limit of the page of claims must be between 1 and %v", ClaimsPageMaxLimit)
+
 type Service interface {
 	Info(id *core.ID) map[string]string
 	RawDump(c *gin.Context)
 	RawImport(raw map[string]string) (int, error)
 	ClaimsDump() map[string]string
+	ClaimsPage(cursor *merkletree.Hash, limit int) ([]string, *merkletree.Hash, error)
+	ClaimsPageHandler(c *gin.Context)
 	Mimc7(data []*big.Int) (*big.Int, error)
 	AddClaimBasic(indexSlot [400 / 8]byte, dataSlot [496 / 8]byte) (*core.ProofClaim, error)
 }
@@ -39,6 +55,19 @@ func (as *ServiceImpl) Info(id *core.ID) map[string]string {
 	o["db"] = as.mt.Storage().Info()
 	o["root"] = as.mt.RootKey().Hex()
 
+	stats, err := as.mt.Stats()
+	if err != nil {
+		o["stats"] = "error getting the merkletree stats"
+	} else {
+		o["leafs"] = strconv.FormatUint(stats.Leafs, 10)
+		o["middles"] = strconv.FormatUint(stats.Middles, 10)
+		o["maxdepth"] = strconv.Itoa(stats.MaxDepth)
+		o["avgdepth"] = strconv.FormatFloat(stats.AvgDepth, 'f', 2, 64)
+		for typ, leafs := range stats.Types {
+			o["type_"+common3.HexEncode(typ[:])] = strconv.FormatUint(leafs, 10)
+		}
+	}
+
 	root, err := as.claimsrv.RootSrv().GetRoot(id)
 	if err != nil {
 		o["root_contract"] = "error getting root from contract"
@@ -105,6 +134,68 @@ func (as *ServiceImpl) ClaimsDump() map[string]string {
 	return data
 }
 
+// ClaimsPage returns up to limit claims in hex of the current root that go
+// after the claim with hIndex cursor, or from the first one if cursor is nil,
+// together with the cursor of the next page, which is nil on the last page.
+// The limit must be between 1 and ClaimsPageMaxLimit.
+func (as *ServiceImpl) ClaimsPage(cursor *merkletree.Hash, limit int) ([]string, *merkletree.Hash, error) {
+	if limit < 1 || limit > ClaimsPageMaxLimit {
+		return nil, nil, ErrInvalidLimit
+	}
+	it := as.mt.LeafIterator(nil)
+	if cursor != nil {
+		var err error
+		if it, err = as.mt.LeafIteratorFrom(nil, cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+	claims := []string{}
+	var next *merkletree.Hash
+	for len(claims) < limit && it.Next() {
+		claims = append(claims, common3.HexEncode(it.Entry().Bytes()))
+		next = it.Cursor()
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !it.Next() {
+		next = nil
+	}
+	return claims, next, it.Err()
+}
+
+// ClaimsPageHandler responds with a page of ClaimsPage in JSON, taking the
+// cursor in hex and the limit from the "cursor" and "limit" query parameters.
+// The limit is ClaimsPageDefaultLimit if it's not given.  The "next" field of
+// the response is the cursor of the next page, or null on the last page.
+func (as *ServiceImpl) ClaimsPageHandler(c *gin.Context) {
+	var cursor *merkletree.Hash
+	if hex := c.Query("cursor"); hex != "" {
+		cursor = &merkletree.Hash{}
+		if err := cursor.UnmarshalText([]byte(hex)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+	limit := ClaimsPageDefaultLimit
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLimit.Error()})
+			return
+		}
+	}
+	claims, next, err := as.ClaimsPage(cursor, limit)
+	if err == ErrInvalidLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"claims": claims, "next": next})
+}
+
 // Mimc7 performs the MIMC7 hash over a given data
 func (as *ServiceImpl) Mimc7(data []*big.Int) (*big.Int, error) {
 	helement, err := mimc7.Hash(data, nil)
@@ -128,7 +219,7 @@ func (as *ServiceImpl) AddClaimBasic(indexSlot [400 / 8]byte, dataSlot [496 / 8]
 	// update Relay Root in Smart Contract
 	as.rootsrv.SetRoot(*as.mt.RootKey())
 
-	proofClaim, err := as.claimsrv.GetClaimProofByHi(claim.Entry().HIndex())
+	proofClaim, err := as.claimsrv.GetClaimProofByHi(as.claimsrv.MT().HIndex(claim.Entry()))
 	if err != nil {
 		fmt.Println("err", err.Error())
 		return nil, err
@@ -108,7 +108,7 @@ func (cs *ServiceImpl) UpdateSetRootClaim(id *core.ID, setRootReq SetRoot0Req) (
 	if err != nil {
 		return nil, err
 	}
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +168,7 @@ func (cs *ServiceImpl) CommitNewIdRoot(id core.ID, kSignPk *ecdsa.PublicKey, roo
 	}
 	// entry := claimSetRootKey.Entry()
 	// version, err := GetNextVersion(cs.mt, entry.HIndex())
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return &core.ClaimSetRootKey{}, err
 	}
@@ -271,7 +271,7 @@ func (cs *ServiceImpl) AddClaimAuthorizeKSignSecp256k1First(id core.ID,
 	}
 
 	// get next version of the claim
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return err
 	}
@@ -323,7 +323,7 @@ func (cs *ServiceImpl) AddUserIdClaim(id core.ID, claimValueMsg ClaimValueMsg) e
 	if err != nil {
 		return err
 	}
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return err
 	}
@@ -368,14 +368,14 @@ func (cs *ServiceImpl) GetIdRoot(id core.ID) (merkletree.Hash, []byte, error) {
 		return merkletree.Hash{}, []byte{}, err
 	}
 
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return merkletree.Hash{}, []byte{}, err
 	}
 	claimSetRootKey.Version = version - 1
 
 	// get proof of SetRootProof in the Relay tree
-	idRootProof, err := cs.mt.GenerateProof(claimSetRootKey.Entry().HIndex(), nil)
+	idRootProof, err := cs.mt.GenerateProof(cs.mt.HIndex(claimSetRootKey.Entry()), nil)
 	if err != nil {
 		return merkletree.Hash{}, []byte{}, err
 	}
@@ -391,13 +391,13 @@ func (cs *ServiceImpl) GetSetRootClaim(id core.ID) (*core.ProofClaim, error) {
 		return nil, err
 	}
 
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
 	claimSetRootKey.Version = version - 1
 
-	return cs.GetClaimProofByHiBlockchain(claimSetRootKey.Entry().HIndex())
+	return cs.GetClaimProofByHiBlockchain(cs.mt.HIndex(claimSetRootKey.Entry()))
 }
 
 // TODO: Remove this
@@ -446,14 +446,14 @@ func (cs *ServiceImpl) GetClaimProofUserByHiOld(id core.ID, hi merkletree.Hash)
 	if err != nil {
 		return nil, err
 	}
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
 	claimSetRootKey.Version = version - 1
 
 	// get the proof of the ClaimSetRootKey in the Relay Tree
-	relayProof, err := cs.mt.GenerateProof(claimSetRootKey.Entry().HIndex(), nil)
+	relayProof, err := cs.mt.GenerateProof(cs.mt.HIndex(claimSetRootKey.Entry()), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -468,7 +468,7 @@ func (cs *ServiceImpl) GetClaimProofUserByHiOld(id core.ID, hi merkletree.Hash)
 	if err != nil {
 		return nil, err
 	}
-	claimSetRootKeyNonRevocationProof, err := getNonRevocationProof(cs.mt, *claimSetRootKey.Entry().HIndex())
+	claimSetRootKeyNonRevocationProof, err := getNonRevocationProof(cs.mt, *cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
@@ -525,14 +525,14 @@ func (cs *ServiceImpl) GetClaimProofUserByHi(id core.ID,
 		return nil, err
 	}
 	// TODO in a future iteration: make an efficient implementation of GetNextVersion
-	version, err := GetNextVersion(cs.mt, claimSetRootKey.Entry().HIndex())
+	version, err := GetNextVersion(cs.mt, cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
 	claimSetRootKey.Version = version - 1
 
 	// Call GetClaimProofByHi to generate a Proof for the top level tree
-	proofClaim, err := cs.GetClaimProofByHi(claimSetRootKey.Entry().HIndex())
+	proofClaim, err := cs.GetClaimProofByHi(cs.mt.HIndex(claimSetRootKey.Entry()))
 	if err != nil {
 		return nil, err
 	}
@@ -626,7 +626,7 @@ func getNonRevocationProof(mt *merkletree.MerkleTree, hi merkletree.Hash) (Proof
 	entry := merkletree.Entry{
 		Data: *leafData,
 	}
-	mp, err := mt.GenerateProof(entry.HIndex(), nil)
+	mp, err := mt.GenerateProof(mt.HIndex(&entry), nil)
 	if err != nil {
 		return ProofTreeLeaf{}, err
 	}
@@ -660,7 +660,7 @@ func GetNextVersion(mt *merkletree.MerkleTree, hi *merkletree.Hash) (uint32, err
 		entry := merkletree.Entry{
 			Data: *leafData,
 		}
-		hi = entry.HIndex()
+		hi = mt.HIndex(&entry)
 	}
 }
 
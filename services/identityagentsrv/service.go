@@ -143,18 +143,11 @@ func (ia *Service) CreateIdentity(claimAuthKOp *merkletree.Entry,
 		return nil, nil, err
 	}
 
-	if err = agent.mt.Add(claimAuthKOp); err != nil {
+	genesisClaims := append([]*merkletree.Entry{claimAuthKOp}, extraGenesisClaims...)
+	if err = agent.mt.AddBatch(genesisClaims); err != nil {
 		return nil, nil, err
 	}
-	tx0.Put(claimAuthKOp.HIndex().Bytes(), claimAuthKOp.Bytes())
-	tx1.Put(claimAuthKOp.HIndex().Bytes(), claimAuthKOp.Bytes())
-	for _, claim := range extraGenesisClaims {
-		// FIXME: If some agent.mt.Add fails, there will be an
-		// inconsistency between agent.mt and agent.storage.claims.emitted
-		err = agent.mt.Add(claim)
-		if err != nil {
-			return nil, nil, err
-		}
+	for _, claim := range genesisClaims {
 		tx0.Put(claim.HIndex().Bytes(), claim.Bytes())
 		tx1.Put(claim.HIndex().Bytes(), claim.Bytes())
 	}
@@ -231,11 +224,13 @@ func (a *Agent) GetRootProof(id *core.ID) (*core.ProofClaim, error) {
 
 func (a *Agent) AddClaims(claims []*merkletree.Entry) error {
 	tx, err := a.storage.claims.emitted.NewTx()
+	if err != nil {
+		return err
+	}
+	if err = a.mt.AddBatch(claims); err != nil {
+		return err
+	}
 	for _, claim := range claims {
-		err = a.mt.Add(claim)
-		if err != nil {
-			return err
-		}
 		tx.Put(claim.HIndex().Bytes(), claim.Bytes())
 	}
 	err = tx.Commit()
@@ -50,14 +50,14 @@ func (ns *ServiceImpl) ResolvClaimAssignName(name string) (*core.ClaimAssignName
 	// build the ClaimAssignName Partial with the given data of the Index
 	claimPartial := core.NewClaimAssignName(name, core.ID{})
 
-	version, err := claimsrv.GetNextVersion(ns.claimsrv.MT(), claimPartial.Entry().HIndex())
+	version, err := claimsrv.GetNextVersion(ns.claimsrv.MT(), ns.claimsrv.MT().HIndex(claimPartial.Entry()))
 	if err != nil {
 		return nil, err
 	}
 	claimPartial.Version = version - 1
 
 	// get the complete ClaimAssignName in that merkle tree position
-	leafDataInPos, err := ns.claimsrv.MT().GetDataByIndex(claimPartial.Entry().HIndex())
+	leafDataInPos, err := ns.claimsrv.MT().GetDataByIndex(ns.claimsrv.MT().HIndex(claimPartial.Entry()))
 	if err != nil {
 		return nil, err
 	}